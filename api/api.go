@@ -25,14 +25,20 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/spothero/optimizely-sdk-go/internal/mediatype"
 	"golang.org/x/xerrors"
 )
 
 const (
-	baseURL        = "https://api.optimizely.com/v2"
-	eventsEndpoint = "https://logx.optimizely.com/v1/events"
+	baseURL          = "https://api.optimizely.com/v2"
+	eventsEndpoint   = "https://logx.optimizely.com/v1/events"
+	euEventsEndpoint = "https://eu.logx.optimizely.com/v1/events"
 )
 
+// RegionEU is the data residency region of Optimizely projects whose events are reported to the EU
+// events API. Projects in any other region, e.g. "US", report events to the default events API.
+const RegionEU = "EU"
+
 // Project is the API representation of an Optimizely project
 type Project struct {
 	ID           int       `json:"id"`
@@ -76,6 +82,13 @@ type Client interface {
 	// return an error if the project cannot be found, the environment cannot be found in the project, or if there
 	// is an error retrieving the datafile.
 	GetDatafile(environmentName string, projectID int) ([]byte, error)
+	// GetDatafileWithLastModified returns the raw contents of the datafile like GetDatafile along with the time
+	// at which the datafile was last modified according to the Last-Modified header of the datafile response.
+	// If the header is missing or malformed, the zero time is returned.
+	GetDatafileWithLastModified(environmentName string, projectID int) ([]byte, time.Time, error)
+	// GetDatafileWithMeta returns the raw contents of the datafile like GetDatafile along with the metadata of the
+	// datafile from the environment, such as its revision and SDK key.
+	GetDatafileWithMeta(environmentName string, projectID int) ([]byte, Datafile, error)
 	// GetEnvironment returns a single environment with a given name within a Project with a given ID.
 	// This method can return an error if the given project ID is not found or the environment with the specified name
 	// is not found.
@@ -85,22 +98,60 @@ type Client interface {
 	// is not found.
 	GetEnvironmentByProjectName(key, projectName string) (Environment, error)
 	// GetEnvironmentsByProjectID returns a list of environments located in the project with the given ID.
-	GetEnvironmentsByProjectID(projectID int) ([]Environment, error)
+	GetEnvironmentsByProjectID(projectID int, options ...ListOption) ([]Environment, error)
 	// GetEnvironmentsByProjectName returns a list of environments located in the project with the given name.
 	// If there is no project with the given name, an error is returned.
-	GetEnvironmentsByProjectName(projectName string) ([]Environment, error)
+	GetEnvironmentsByProjectName(projectName string, options ...ListOption) ([]Environment, error)
 	// GetProjects returns all Optimizely Projects within the Optimizely account that the client has access to.
-	GetProjects() ([]Project, error)
+	GetProjects(options ...ListOption) ([]Project, error)
 	// ReportEvents sends serialized events to the Optimizely events API.
 	ReportEvents(events []byte) error
+	// ReportEventsForRegion sends serialized events to the Optimizely events API of the given data
+	// residency region, e.g. RegionEU. Events of any other region are sent like ReportEvents.
+	ReportEventsForRegion(region string, events []byte) error
 }
 
-func (c client) GetProjects() ([]Project, error) {
+// ListOption is an option for a single request made by one of the list methods of a Client.
+type ListOption func(*listOptions)
+
+// listOptions holds the options of a single request made by one of the list methods of a Client.
+type listOptions struct {
+	perPage int
+}
+
+// ListPerPage overrides the number of items requested on each page for a single call to one of the
+// list methods of a Client. If this option is not provided, the PerPage value of the Client is used.
+func ListPerPage(i int) ListOption {
+	return func(o *listOptions) {
+		o.perPage = i
+	}
+}
+
+// listQuery applies the given options to the query of a list request. The query is returned unmodified
+// if no options change it.
+func listQuery(query url.Values, options []ListOption) url.Values {
+	o := listOptions{}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.perPage <= 0 {
+		return query
+	}
+	q := make(url.Values, len(query)+1)
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("per_page", fmt.Sprintf("%d", o.perPage))
+	return q
+}
+
+func (c client) GetProjects(options ...ListOption) ([]Project, error) {
 	responses, err := c.apiClient.sendPaginatedAPIRequest(
-		http.MethodGet, fmt.Sprintf("%s/projects", baseURL), nil, nil, nil)
+		http.MethodGet, fmt.Sprintf("%s/projects", baseURL), nil, listQuery(nil, options), nil)
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponses(responses)
 	projects := make([]Project, 0)
 	for _, response := range responses {
 		var projectsInResponse []Project
@@ -113,14 +164,15 @@ func (c client) GetProjects() ([]Project, error) {
 	return projects, nil
 }
 
-func (c client) GetEnvironmentsByProjectID(projectID int) ([]Environment, error) {
+func (c client) GetEnvironmentsByProjectID(projectID int, options ...ListOption) ([]Environment, error) {
 	query := url.Values{}
 	query.Set("project_id", fmt.Sprintf("%d", projectID))
 	responses, err := c.apiClient.sendPaginatedAPIRequest(
-		http.MethodGet, fmt.Sprintf("%s/environments", baseURL), nil, query, nil)
+		http.MethodGet, fmt.Sprintf("%s/environments", baseURL), nil, listQuery(query, options), nil)
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponses(responses)
 	environments := make([]Environment, 0)
 	for _, response := range responses {
 		var environmentsInResponse []Environment
@@ -133,14 +185,14 @@ func (c client) GetEnvironmentsByProjectID(projectID int) ([]Environment, error)
 	return environments, nil
 }
 
-func (c client) GetEnvironmentsByProjectName(projectName string) ([]Environment, error) {
+func (c client) GetEnvironmentsByProjectName(projectName string, options ...ListOption) ([]Environment, error) {
 	projects, err := c.GetProjects()
 	if err != nil {
 		return nil, xerrors.Errorf("failed to get environments because failed to get projects: %w", err)
 	}
 	for _, proj := range projects {
 		if proj.Name == projectName {
-			return c.GetEnvironmentsByProjectID(proj.ID)
+			return c.GetEnvironmentsByProjectID(proj.ID, options...)
 		}
 	}
 	return nil, fmt.Errorf("could not find project with name %s", projectName)
@@ -173,29 +225,91 @@ func (c client) GetEnvironmentByProjectID(key string, projectID int) (Environmen
 }
 
 func (c client) ReportEvents(events []byte) error {
-	response, err := c.apiClient.httpClient().Post(
-		eventsEndpoint, "application/json", bytes.NewBuffer(events))
+	return c.ReportEventsForRegion("", events)
+}
+
+func (c client) ReportEventsForRegion(region string, events []byte) error {
+	request, err := http.NewRequest(http.MethodPost, c.apiClient.eventsURL(region), bytes.NewBuffer(events))
+	if err != nil {
+		return xerrors.Errorf("error creating events request: %w", err)
+	}
+	for key, values := range c.apiClient.eventsHeaders() {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", c.apiClient.userAgentHeader())
+	response, err := c.apiClient.eventsHTTPClient().Do(request)
 	if err != nil {
 		return xerrors.Errorf("error reporting events to Optimizely API: %w", err)
 	}
+	// the response must be closed for the connection to be reused by subsequent reports
+	defer drainAndClose(response.Body)
 	if response.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("unexpected status code (%d) received from events API", response.StatusCode)
+		return &EventsStatusError{StatusCode: response.StatusCode}
 	}
 	return nil
 }
 
+// EventsStatusError is returned when the events API responds to a report with an unexpected status
+// code. Reports rejected with a 4xx status code, other than 429 Too Many Requests, will be rejected
+// again if retried.
+type EventsStatusError struct {
+	StatusCode int
+}
+
+func (e *EventsStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code (%d) received from events API", e.StatusCode)
+}
+
 func (c client) GetDatafile(environmentName string, projectID int) ([]byte, error) {
+	datafile, _, _, err := c.getDatafile(environmentName, projectID)
+	return datafile, err
+}
+
+func (c client) GetDatafileWithLastModified(environmentName string, projectID int) ([]byte, time.Time, error) {
+	datafile, _, lastModified, err := c.getDatafile(environmentName, projectID)
+	return datafile, lastModified, err
+}
+
+func (c client) GetDatafileWithMeta(environmentName string, projectID int) ([]byte, Datafile, error) {
+	datafile, meta, _, err := c.getDatafile(environmentName, projectID)
+	return datafile, meta, err
+}
+
+// getDatafile retrieves the datafile of the given environment and returns its contents, the datafile
+// metadata from the environment, and the time the datafile was last modified.
+func (c client) getDatafile(environmentName string, projectID int) ([]byte, Datafile, time.Time, error) {
 	environment, err := c.GetEnvironmentByProjectID(environmentName, projectID)
 	if err != nil {
-		return nil, err
+		return nil, Datafile{}, time.Time{}, err
+	}
+	request, err := http.NewRequest(http.MethodGet, environment.Datafile.URL, nil)
+	if err != nil {
+		return nil, Datafile{}, time.Time{}, xerrors.Errorf("error creating datafile request: %w", err)
 	}
-	response, err := c.apiClient.httpClient().Get(environment.Datafile.URL)
+	request.Header.Set("User-Agent", c.apiClient.userAgentHeader())
+	response, err := c.apiClient.httpClient().Do(request)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to retrieve datafile from %s: %w", environment.Datafile.URL, err)
+		return nil, Datafile{}, time.Time{}, xerrors.Errorf(
+			"failed to retrieve datafile from %s: %w", environment.Datafile.URL, err)
 	}
+	defer drainAndClose(response.Body)
 	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return nil, xerrors.Errorf(
+		return nil, Datafile{}, time.Time{}, xerrors.Errorf(
 			"invalid response (%d) received while retrieving datafile: %w", response.StatusCode, err)
 	}
-	return ioutil.ReadAll(response.Body)
+	datafile, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, Datafile{}, time.Time{}, xerrors.Errorf("failed to read datafile: %w", err)
+	}
+	// catch error pages, e.g. from a misconfigured proxy, that would otherwise fail to parse as a datafile
+	if contentType := response.Header.Get("Content-Type"); contentType != "" && !mediatype.IsJSON(contentType, datafile) {
+		return nil, Datafile{}, time.Time{}, fmt.Errorf(
+			"unexpected content type %q received while retrieving datafile from %s", contentType, environment.Datafile.URL)
+	}
+	// the Last-Modified header is informational, so the zero time is used if it can't be parsed
+	lastModified, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+	return datafile, environment.Datafile, lastModified, nil
 }
@@ -16,18 +16,25 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
 )
 
 type mockApiClient struct {
@@ -48,6 +55,22 @@ func (m *mockApiClient) httpClient() *http.Client {
 	return m.Called().Get(0).(*http.Client)
 }
 
+func (m *mockApiClient) userAgentHeader() string {
+	return m.Called().String(0)
+}
+
+func (m *mockApiClient) eventsHTTPClient() *http.Client {
+	return m.Called().Get(0).(*http.Client)
+}
+
+func (m *mockApiClient) eventsURL(region string) string {
+	return m.Called(region).String(0)
+}
+
+func (m *mockApiClient) eventsHeaders() http.Header {
+	return m.Called().Get(0).(http.Header)
+}
+
 func createMockClient(projectResponses []string, projectErr error, environmentResponses []string, environmentErr error, environmentProjectID int) (*mockApiClient, *mock.Call, *mock.Call) {
 	mc := &mockApiClient{}
 	prs := make([]*http.Response, 0, len(projectResponses))
@@ -193,6 +216,31 @@ func TestClient_GetProjects(t *testing.T) {
 	}
 }
 
+func TestClient_GetProjects_listPerPage(t *testing.T) {
+	mc := &mockApiClient{}
+	defer mc.AssertExpectations(t)
+	mc.On(
+		"sendPaginatedAPIRequest",
+		http.MethodGet, fmt.Sprintf("%s/projects", baseURL), nil, url.Values{"per_page": []string{"50"}}, http.Header(nil),
+	).Return([]*http.Response{}, nil).Once()
+	c := client{apiClient: mc}
+	_, err := c.GetProjects(ListPerPage(50))
+	assert.NoError(t, err)
+}
+
+func TestListQuery(t *testing.T) {
+	query := url.Values{"project_id": []string{"1"}}
+	assert.Equal(t, query, listQuery(query, nil))
+	assert.Nil(t, listQuery(nil, []ListOption{ListPerPage(0)}))
+	assert.Equal(
+		t,
+		url.Values{"project_id": []string{"1"}, "per_page": []string{"10"}},
+		listQuery(query, []ListOption{ListPerPage(10)}),
+	)
+	// the caller's query is not modified
+	assert.Equal(t, url.Values{"project_id": []string{"1"}}, query)
+}
+
 func TestClient_GetEnvironmentsByProjectID(t *testing.T) {
 	const projectID = 1
 	tests := []struct {
@@ -697,22 +745,128 @@ func TestClient_reportEvents(t *testing.T) {
 			mt := &mockTransport{}
 			mt.On("RoundTrip", mock.Anything).Return(test.response, test.httpErr).Once()
 			mc := &mockApiClient{}
-			mc.On("httpClient").Return(&http.Client{Transport: mt})
+			mc.On("eventsHTTPClient").Return(&http.Client{Transport: mt})
+			mc.On("eventsURL", "").Return(eventsEndpoint)
+			mc.On("userAgentHeader").Return("user agent")
+			mc.On("eventsHeaders").Return(http.Header{
+				"X-Forwarder-Token": []string{"token"},
+				"Content-Type":      []string{"text/plain"},
+			})
 			defer mt.AssertExpectations(t)
 			err := client{apiClient: mc}.ReportEvents(test.body)
 			if test.expectErr {
 				assert.Error(t, err)
+				var statusErr *EventsStatusError
+				if test.response != nil && assert.True(t, xerrors.As(err, &statusErr)) {
+					assert.Equal(t, test.response.StatusCode, statusErr.StatusCode)
+				}
 				return
 			}
 			assert.NoError(t, err)
+			sentRequest := mt.Calls[0].Arguments[0].(*http.Request)
+			assert.Equal(t, []string{"application/json"}, sentRequest.Header["Content-Type"])
+			assert.Equal(t, "user agent", sentRequest.Header.Get("User-Agent"))
+			assert.Equal(t, "token", sentRequest.Header.Get("X-Forwarder-Token"))
+			assert.Equal(t, eventsEndpoint, sentRequest.URL.String())
 			sentBody := bytes.Buffer{}
-			_, err = sentBody.ReadFrom(mt.Calls[0].Arguments[0].(*http.Request).Body)
+			_, err = sentBody.ReadFrom(sentRequest.Body)
 			require.NoError(t, err)
 			assert.Equal(t, string(test.body), sentBody.String())
 		})
 	}
 }
 
+// redirects every request to a test server and counts the connections dialed to it
+type countingTransport struct {
+	http.Transport
+	serverURL *url.URL
+	dials     int32
+}
+
+func newCountingTransport(serverURL string) (*countingTransport, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	ct := &countingTransport{serverURL: u}
+	dialer := &net.Dialer{}
+	ct.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&ct.dials, 1)
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return ct, nil
+}
+
+func (ct *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request.URL.Scheme = ct.serverURL.Scheme
+	request.URL.Host = ct.serverURL.Host
+	return ct.Transport.RoundTrip(request)
+}
+
+func TestClient_ReportEvents_connectionReuse(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		expectErr  bool
+	}{
+		{"connection is reused after successful reports", http.StatusNoContent, "", false},
+		{"connection is reused after failed reports", http.StatusBadRequest, "invalid events", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.statusCode)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			transport, err := newCountingTransport(server.URL)
+			require.NoError(t, err)
+			defer transport.CloseIdleConnections()
+			c := client{apiClient: optimizelyAPIClient{Client: http.Client{Transport: transport}}}
+			for i := 0; i < 3; i++ {
+				err := c.ReportEvents([]byte("{}"))
+				if test.expectErr {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			}
+			assert.Equal(t, int32(1), atomic.LoadInt32(&transport.dials))
+		})
+	}
+}
+
+func TestClient_ReportEvents_unixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "optimizely")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "events.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan []byte, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		receivedBody <- body
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	c := NewClient(EventsUnixSocket(socket), EventsHeader("X-Forwarder-Token", "token"))
+	require.NoError(t, c.ReportEvents([]byte(`{"visitors": []}`)))
+	request := <-received
+	assert.Equal(t, http.MethodPost, request.Method)
+	assert.Equal(t, "/v1/events", request.URL.Path)
+	assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+	assert.Equal(t, "token", request.Header.Get("X-Forwarder-Token"))
+	assert.Equal(t, `{"visitors": []}`, string(<-receivedBody))
+	// other requests do not use the socket
+	assert.Nil(t, c.(client).apiClient.httpClient().Transport)
+}
+
 func TestClient_GetDatafile(t *testing.T) {
 	const (
 		projectID       = 3000
@@ -788,6 +942,7 @@ func TestClient_GetDatafile(t *testing.T) {
 			resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(test.responseBody)), StatusCode: test.statusCode}
 			mt.On("RoundTrip", mock.Anything).Return(resp, test.httpErr).Maybe()
 			mc.On("httpClient").Return(&http.Client{Transport: mt}).Maybe()
+			mc.On("userAgentHeader").Return("user agent").Maybe()
 			c := client{apiClient: mc}
 			df, err := c.GetDatafile(environment, projectID)
 			if test.expectErr {
@@ -799,3 +954,139 @@ func TestClient_GetDatafile(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_GetDatafile_contentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expectErr   bool
+	}{
+		{"JSON content type is accepted", "application/json", `{"version": "4"}`, false},
+		{"JSON content type with parameters is accepted", "application/json; charset=utf-8", `{"version": "4"}`, false},
+		{"JSON suffix is accepted", "application/vnd.optimizely+json", `{"version": "4"}`, false},
+		{"other content type with JSON body is accepted", "binary/octet-stream", ` {"version": "4"}`, false},
+		{"missing content type is accepted", "", "i am a datafile", false},
+		{"HTML error page returns error", "text/html; charset=utf-8", "<html><body>Sign in</body></html>", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mc, _, environmentsAPICall := createMockClient(
+				nil, nil, []string{`[{"key": "production", "datafile": {"url": "https://datafile.url"}}]`}, nil, 3000)
+			environmentsAPICall.Once()
+			defer mc.AssertExpectations(t)
+			mt := &mockTransport{}
+			defer mt.AssertExpectations(t)
+			header := http.Header{}
+			if test.contentType != "" {
+				header.Set("Content-Type", test.contentType)
+			}
+			resp := &http.Response{
+				Body:       ioutil.NopCloser(strings.NewReader(test.body)),
+				StatusCode: http.StatusOK,
+				Header:     header,
+			}
+			mt.On("RoundTrip", mock.Anything).Return(resp, nil).Once()
+			mc.On("httpClient").Return(&http.Client{Transport: mt}).Once()
+			mc.On("userAgentHeader").Return("user agent").Once()
+			df, err := client{apiClient: mc}.GetDatafile("production", 3000)
+			if test.expectErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "unexpected content type")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.body, string(df))
+		})
+	}
+}
+
+func TestClient_GetDatafileWithLastModified(t *testing.T) {
+	const (
+		projectID       = 3000
+		environment     = "production"
+		environmentBody = `[{"key": "production", "project_id": 3000, "datafile": {"url": "https://datafile.url"}}]`
+	)
+	tests := []struct {
+		name                 string
+		lastModified         string
+		expectedLastModified time.Time
+	}{
+		{
+			"last modified time is parsed from the response",
+			"Wed, 21 Oct 2015 07:28:00 GMT",
+			time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		}, {
+			"missing last modified header returns the zero time",
+			"",
+			time.Time{},
+		}, {
+			"malformed last modified header returns the zero time",
+			"yesterday",
+			time.Time{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mc, _, environmentsAPICall := createMockClient(nil, nil, []string{environmentBody}, nil, projectID)
+			environmentsAPICall.Once()
+			defer mc.AssertExpectations(t)
+			mt := &mockTransport{}
+			defer mt.AssertExpectations(t)
+			resp := &http.Response{
+				Body:       ioutil.NopCloser(strings.NewReader("i am a datafile")),
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+			}
+			if test.lastModified != "" {
+				resp.Header.Set("Last-Modified", test.lastModified)
+			}
+			mt.On("RoundTrip", mock.Anything).Return(resp, nil).Once()
+			mc.On("httpClient").Return(&http.Client{Transport: mt}).Once()
+			mc.On("userAgentHeader").Return("user agent").Once()
+			df, lastModified, err := client{apiClient: mc}.GetDatafileWithLastModified(environment, projectID)
+			require.NoError(t, err)
+			assert.Equal(t, "i am a datafile", string(df))
+			assert.True(t, test.expectedLastModified.Equal(lastModified))
+		})
+	}
+}
+
+func TestClient_GetDatafileWithMeta(t *testing.T) {
+	const (
+		projectID       = 3000
+		environment     = "production"
+		environmentBody = `
+[
+  {
+    "key": "production",
+    "project_id": 3000,
+    "datafile": {
+      "id": 1,
+      "latest_file_size": 15,
+      "revision": 7,
+      "sdk_key": "abc123",
+      "url": "https://datafile.url"
+    }
+  }
+]
+`
+	)
+	mc, _, environmentsAPICall := createMockClient(nil, nil, []string{environmentBody}, nil, projectID)
+	environmentsAPICall.Once()
+	defer mc.AssertExpectations(t)
+	mt := &mockTransport{}
+	defer mt.AssertExpectations(t)
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader("i am a datafile")), StatusCode: http.StatusOK}
+	mt.On("RoundTrip", mock.Anything).Return(resp, nil).Once()
+	mc.On("httpClient").Return(&http.Client{Transport: mt}).Once()
+	mc.On("userAgentHeader").Return("user agent").Once()
+	df, meta, err := client{apiClient: mc}.GetDatafileWithMeta(environment, projectID)
+	require.NoError(t, err)
+	assert.Equal(t, "i am a datafile", string(df))
+	assert.Equal(
+		t,
+		Datafile{ID: 1, LatestFileSize: 15, Revision: 7, SDKKey: "abc123", URL: "https://datafile.url"},
+		meta,
+	)
+}
@@ -15,11 +15,18 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/spothero/optimizely-sdk-go/internal/version"
 	"github.com/tomnomnom/linkheader"
 	"golang.org/x/xerrors"
 )
@@ -35,12 +42,90 @@ type apiClient interface {
 	sendAPIRequest(method, url string, body io.Reader, query url.Values, headers http.Header) (*http.Response, error)
 	sendPaginatedAPIRequest(method, url string, body io.Reader, query url.Values, headers http.Header) ([]*http.Response, error)
 	httpClient() *http.Client
+	userAgentHeader() string
+	eventsHeaders() http.Header
+	eventsHTTPClient() *http.Client
+	eventsURL(region string) string
 }
 
 type optimizelyAPIClient struct {
 	http.Client
-	token   string
-	perPage int
+	token      string
+	perPage    int
+	pagination PaginationStrategy
+	userAgent  string
+	// additional headers sent when reporting events
+	events http.Header
+	// client and URL used to report events instead of the Optimizely events API, if set
+	eventsClient   *http.Client
+	eventsEndpoint string
+	// called with the rate limit status of every response from the Optimizely API, if set
+	onRateLimit func(RateLimit)
+}
+
+// RateLimit is the rate limit status reported by the Optimizely API in the headers of a response.
+type RateLimit struct {
+	// Limit is the number of requests allowed in the current window, from X-RateLimit-Limit.
+	// It is zero if the header was not present.
+	Limit int
+	// Remaining is the number of requests remaining in the current window, from X-RateLimit-Remaining.
+	Remaining int
+	// Reset is the time until the current window resets, from X-RateLimit-Reset.
+	// It is zero if the header was not present.
+	Reset time.Duration
+}
+
+// parseRateLimit parses the rate limit headers of a response. False is returned if the response
+// does not have a valid X-RateLimit-Remaining header; the other headers are optional.
+func parseRateLimit(header http.Header) (RateLimit, bool) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+	rl := RateLimit{Remaining: remaining}
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		rl.Limit = limit
+	}
+	if reset, err := strconv.Atoi(header.Get("X-RateLimit-Reset")); err == nil {
+		rl.Reset = time.Duration(reset) * time.Second
+	}
+	return rl, true
+}
+
+// the product token of this library in the default user agent
+const userAgentProduct = "optimizely-sdk-go"
+
+// User-Agent header sent with every request unless overridden with the UserAgent option. The
+// version of this library is appended if it can be read from the Go build info.
+var defaultUserAgent = userAgent(version.Version)
+
+// userAgent returns the default user agent, in the product/version form of RFC 7231, for the given
+// version of this library, if known.
+func userAgent(moduleVersion string) string {
+	if moduleVersion == "" {
+		return userAgentProduct
+	}
+	return userAgentProduct + "/" + moduleVersion
+}
+
+// PaginationStrategy finds the URL of the next page of results given a response from a paginated
+// API request. An empty URL is returned when there are no more pages. Strategies that read the
+// response body must replace it with an unread copy so that the body can still be decoded.
+type PaginationStrategy interface {
+	NextURL(response *http.Response) (string, error)
+}
+
+// LinkHeaderPagination is the default PaginationStrategy used by the Optimizely API, which follows
+// the RFC 5988 Link header with the "next" relation.
+type LinkHeaderPagination struct{}
+
+// NextURL returns the URL of the Link header with the "next" relation, if present.
+func (LinkHeaderPagination) NextURL(response *http.Response) (string, error) {
+	next := linkheader.Parse(response.Header.Get("link")).FilterByRel("next")
+	if len(next) == 0 {
+		return "", nil
+	}
+	return next[0].URL, nil
 }
 
 // NewClient constructs a new Optimizely API client from optional provided options.
@@ -71,6 +156,116 @@ func PerPage(i int) func(*client) {
 	}
 }
 
+// UserAgent sets the User-Agent header sent with every request to Optimizely as an option when building
+// a new Client. If this option is not provided to NewClient, the user agent is the name of this library
+// followed by its version, if known, e.g. optimizely-sdk-go/v1.0.0.
+func UserAgent(userAgent string) func(*client) {
+	return func(c *client) {
+		ac := c.apiClient.(optimizelyAPIClient)
+		ac.userAgent = userAgent
+		c.apiClient = ac
+	}
+}
+
+// EventsHeader adds a header sent with every request to the events API as an option when building a
+// new Client. This is useful for authenticating with a forwarder that relays events to Optimizely.
+// The option may be provided more than once. The Content-Type and User-Agent headers cannot be
+// overridden.
+func EventsHeader(key, value string) func(*client) {
+	return func(c *client) {
+		ac := c.apiClient.(optimizelyAPIClient)
+		headers := ac.events.Clone()
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Add(key, value)
+		ac.events = headers
+		c.apiClient = ac
+	}
+}
+
+// EventsUnixSocket reports events to a forwarder listening on the Unix domain socket at the given
+// path instead of the Optimizely events API, as an option when building a new Client. Events are
+// POSTed over plain HTTP to the /v1/events path of the forwarder, with the host "unix". All other
+// requests, such as to the management API, are unaffected.
+func EventsUnixSocket(path string) func(*client) {
+	return func(c *client) {
+		ac := c.apiClient.(optimizelyAPIClient)
+		dialer := &net.Dialer{}
+		ac.eventsClient = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		}
+		ac.eventsEndpoint = "http://unix/v1/events"
+		c.apiClient = ac
+	}
+}
+
+// Pagination sets the strategy used to follow paginated responses as an option when building a
+// new Client. This is useful when accessing the API through a proxy that paginates differently. If
+// this option is not provided to NewClient, LinkHeaderPagination is used.
+func Pagination(strategy PaginationStrategy) func(*client) {
+	return func(c *client) {
+		ac := c.apiClient.(optimizelyAPIClient)
+		ac.pagination = strategy
+		c.apiClient = ac
+	}
+}
+
+// MinTLSVersion sets the minimum TLS version, e.g. tls.VersionTLS12, used for all connections to
+// Optimizely, including the management API, the events API, and datafile downloads, as an option
+// when building a new Client.
+func MinTLSVersion(version uint16) func(*client) {
+	return func(c *client) {
+		ac := c.apiClient.(optimizelyAPIClient)
+		t := ac.transport()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.MinVersion = version
+		c.apiClient = ac
+	}
+}
+
+// ForceAttemptHTTP2 controls whether HTTP/2 is attempted for connections to Optimizely even
+// though the transport of the client has a custom TLS configuration, e.g. one set by
+// MinTLSVersion, as an option when building a new Client. HTTP/2 is attempted by default, so
+// this option is typically used to disable it.
+func ForceAttemptHTTP2(force bool) func(*client) {
+	return func(c *client) {
+		ac := c.apiClient.(optimizelyAPIClient)
+		ac.transport().ForceAttemptHTTP2 = force
+		c.apiClient = ac
+	}
+}
+
+// OnRateLimit sets a callback that is invoked with the rate limit status reported by the Optimizely
+// API as an option when building a new Client. The callback is invoked synchronously for every
+// response with rate limit headers, including error responses, before the request's result is
+// returned, so callers can back off before they reach the limit. Requests to the events API are not
+// rate limited and do not invoke the callback.
+func OnRateLimit(callback func(RateLimit)) func(*client) {
+	return func(c *client) {
+		ac := c.apiClient.(optimizelyAPIClient)
+		ac.onRateLimit = callback
+		c.apiClient = ac
+	}
+}
+
+// transport returns the HTTP transport of the client, creating one from http.DefaultTransport
+// if the client does not already have one.
+func (c *optimizelyAPIClient) transport() *http.Transport {
+	t, ok := c.Transport.(*http.Transport)
+	if !ok {
+		t = http.DefaultTransport.(*http.Transport).Clone()
+		c.Transport = t
+	}
+	return t
+}
+
 // sends a single API request to the Optimizely API and returns the response or error. If the response is a non-200
 // level response, an error is also returned.
 func (c optimizelyAPIClient) sendAPIRequest(method, uri string, body io.Reader, query url.Values, headers http.Header) (*http.Response, error) {
@@ -85,10 +280,6 @@ func (c optimizelyAPIClient) sendAPIRequest(method, uri string, body io.Reader,
 			q.Add(k, s)
 		}
 	}
-	// append per_page to the query
-	if c.perPage > 0 {
-		q.Set("per_page", fmt.Sprintf("%d", c.perPage))
-	}
 	req.URL.RawQuery = q.Encode()
 
 	// merge provided headers into the request's headers
@@ -97,6 +288,7 @@ func (c optimizelyAPIClient) sendAPIRequest(method, uri string, body io.Reader,
 			req.Header.Add(k, s)
 		}
 	}
+	req.Header.Set("User-Agent", c.userAgentHeader())
 	// append authorization header if token is not empty
 	if c.token != "" {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
@@ -105,7 +297,13 @@ func (c optimizelyAPIClient) sendAPIRequest(method, uri string, body io.Reader,
 	if err != nil {
 		return nil, xerrors.Errorf("error making Optimizely API request: %w", err)
 	}
+	if c.onRateLimit != nil {
+		if rl, ok := parseRateLimit(resp.Header); ok {
+			c.onRateLimit(rl)
+		}
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		drainAndClose(resp.Body)
 		return nil, xerrors.Errorf("received %d status from Optimizely API", resp.StatusCode)
 	}
 	return resp, nil
@@ -113,23 +311,85 @@ func (c optimizelyAPIClient) sendAPIRequest(method, uri string, body io.Reader,
 
 // sends a request to the Optimizely API and follows all pagination links and aggregates the responses.
 func (c optimizelyAPIClient) sendPaginatedAPIRequest(method, uri string, body io.Reader, query url.Values, headers http.Header) ([]*http.Response, error) {
+	pagination := c.pagination
+	if pagination == nil {
+		pagination = LinkHeaderPagination{}
+	}
+	// per_page only applies to paginated requests, so it is added here rather than in sendAPIRequest
+	// unless it has been overridden for this request
+	if c.perPage > 0 && query.Get("per_page") == "" {
+		paginatedQuery := make(url.Values, len(query)+1)
+		for k, v := range query {
+			paginatedQuery[k] = v
+		}
+		paginatedQuery.Set("per_page", fmt.Sprintf("%d", c.perPage))
+		query = paginatedQuery
+	}
 	responses := make([]*http.Response, 0, 1)
 	curURL := uri
 	for {
 		resp, err := c.sendAPIRequest(method, curURL, body, query, headers)
 		if err != nil {
+			closeResponses(responses)
 			return nil, err
 		}
 		responses = append(responses, resp)
-		links := linkheader.Parse(resp.Header.Get("link"))
-		next := links.FilterByRel("next")
-		if len(next) == 0 {
+		next, err := pagination.NextURL(resp)
+		if err != nil {
+			closeResponses(responses)
+			return nil, xerrors.Errorf("error finding next page of Optimizely API results: %w", err)
+		}
+		if next == "" {
 			return responses, nil
 		}
-		curURL = next[0].URL
+		curURL = next
 	}
 }
 
 func (c optimizelyAPIClient) httpClient() *http.Client {
 	return &c.Client
 }
+
+func (c optimizelyAPIClient) eventsHTTPClient() *http.Client {
+	if c.eventsClient != nil {
+		return c.eventsClient
+	}
+	return &c.Client
+}
+
+// eventsURL returns the URL that events of the given region are reported to. An events endpoint
+// configured on the client, e.g. with EventsUnixSocket, takes precedence over the region.
+func (c optimizelyAPIClient) eventsURL(region string) string {
+	if c.eventsEndpoint != "" {
+		return c.eventsEndpoint
+	}
+	if region == RegionEU {
+		return euEventsEndpoint
+	}
+	return eventsEndpoint
+}
+
+func (c optimizelyAPIClient) eventsHeaders() http.Header {
+	return c.events
+}
+
+func (c optimizelyAPIClient) userAgentHeader() string {
+	if c.userAgent != "" {
+		return c.userAgent
+	}
+	return defaultUserAgent
+}
+
+// drainAndClose reads any remaining data from a response body and closes it so that the underlying
+// connection can be reused for subsequent requests.
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(ioutil.Discard, body)
+	_ = body.Close()
+}
+
+// closeResponses drains and closes the bodies of all the given responses.
+func closeResponses(responses []*http.Response) {
+	for _, response := range responses {
+		drainAndClose(response.Body)
+	}
+}
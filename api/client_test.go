@@ -15,6 +15,7 @@
 package api
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -23,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -40,9 +42,9 @@ func TestNewClient(t *testing.T) {
 			[]func(*client){},
 			client{apiClient: optimizelyAPIClient{perPage: 25}},
 		}, {
-			"token and per page are set when provided as options",
-			[]func(*client){Token("abc"), PerPage(10)},
-			client{apiClient: optimizelyAPIClient{token: "abc", perPage: 10}},
+			"token, per page, and pagination are set when provided as options",
+			[]func(*client){Token("abc"), PerPage(10), Pagination(LinkHeaderPagination{})},
+			client{apiClient: optimizelyAPIClient{token: "abc", perPage: 10, pagination: LinkHeaderPagination{}}},
 		},
 	}
 	for _, test := range tests {
@@ -52,6 +54,60 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestMinTLSVersion(t *testing.T) {
+	c := NewClient(MinTLSVersion(tls.VersionTLS12)).(client)
+	transport, ok := c.apiClient.(optimizelyAPIClient).Transport.(*http.Transport)
+	require.True(t, ok)
+	require.NotNil(t, transport.TLSClientConfig)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+	// the default transport must not be modified
+	assert.False(t, transport == http.DefaultTransport)
+}
+
+func TestForceAttemptHTTP2(t *testing.T) {
+	for _, force := range []bool{true, false} {
+		t.Run(fmt.Sprintf("force %v", force), func(t *testing.T) {
+			c := NewClient(MinTLSVersion(tls.VersionTLS12), ForceAttemptHTTP2(force)).(client)
+			transport, ok := c.apiClient.(optimizelyAPIClient).Transport.(*http.Transport)
+			require.True(t, ok)
+			assert.Equal(t, force, transport.ForceAttemptHTTP2)
+		})
+	}
+	// the default transport must not be modified
+	assert.True(t, http.DefaultTransport.(*http.Transport).ForceAttemptHTTP2)
+}
+
+func TestEventsHeader(t *testing.T) {
+	c := NewClient(EventsHeader("X-Forwarder-Token", "token"), EventsHeader("X-Team", "a"), EventsHeader("X-Team", "b")).(client)
+	assert.Equal(
+		t,
+		http.Header{"X-Forwarder-Token": []string{"token"}, "X-Team": []string{"a", "b"}},
+		c.apiClient.eventsHeaders(),
+	)
+	assert.Nil(t, NewClient().(client).apiClient.eventsHeaders())
+}
+
+func TestOptimizelyAPIClient_eventsURL(t *testing.T) {
+	c := optimizelyAPIClient{}
+	assert.Equal(t, eventsEndpoint, c.eventsURL(""))
+	assert.Equal(t, eventsEndpoint, c.eventsURL("US"))
+	assert.Equal(t, euEventsEndpoint, c.eventsURL(RegionEU))
+	// an endpoint configured on the client takes precedence over the region
+	ac := NewClient(EventsUnixSocket("/tmp/events.sock")).(client).apiClient
+	assert.Equal(t, "http://unix/v1/events", ac.eventsURL(RegionEU))
+}
+
+func TestOptimizelyAPIClient_userAgentHeader(t *testing.T) {
+	assert.Equal(t, defaultUserAgent, optimizelyAPIClient{}.userAgentHeader())
+	c := NewClient(UserAgent("my-service/1.0")).(client)
+	assert.Equal(t, "my-service/1.0", c.apiClient.userAgentHeader())
+}
+
+func TestUserAgent(t *testing.T) {
+	assert.Equal(t, "optimizely-sdk-go", userAgent(""))
+	assert.Equal(t, "optimizely-sdk-go/v1.2.3", userAgent("v1.2.3"))
+}
+
 type mockTransport struct{ mock.Mock }
 
 func (m *mockTransport) RoundTrip(request *http.Request) (*http.Response, error) {
@@ -121,19 +177,20 @@ func TestOptimizelyAPIClient_sendAPIRequest(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mt := &mockTransport{}
 			client := optimizelyAPIClient{
-				Client:  http.Client{Transport: mt},
-				token:   "token",
-				perPage: 5,
+				Client:    http.Client{Transport: mt},
+				token:     "token",
+				perPage:   5,
+				userAgent: "user agent",
 			}
 			if test.expectRequestSent {
 				mt.On("RoundTrip", mock.Anything).Return(test.response, test.httpErr).Once()
 				defer mt.AssertExpectations(t)
 				defer func() {
 					sentRequest := mt.Calls[0].Arguments[0].(*http.Request)
-					requestedPerPage, err := strconv.Atoi(sentRequest.URL.Query().Get("per_page"))
-					require.NoError(t, err)
-					assert.Equal(t, client.perPage, requestedPerPage)
+					// per_page is only sent with paginated requests
+					assert.NotContains(t, sentRequest.URL.Query(), "per_page")
 					assert.Equal(t, fmt.Sprintf("Bearer %s", client.token), sentRequest.Header.Get("Authorization"))
+					assert.Equal(t, client.userAgent, sentRequest.Header.Get("User-Agent"))
 					for queryName, queryVal := range test.additionalQueryParams {
 						assert.Equal(t, queryVal[0], sentRequest.URL.Query().Get(queryName))
 					}
@@ -155,6 +212,17 @@ func TestOptimizelyAPIClient_sendAPIRequest(t *testing.T) {
 	}
 }
 
+// paginates using a hypothetical X-Next-Page header
+type nextPageHeaderPagination struct{}
+
+func (nextPageHeaderPagination) NextURL(response *http.Response) (string, error) {
+	next := response.Header.Get("X-Next-Page")
+	if next == "invalid" {
+		return "", fmt.Errorf("invalid next page")
+	}
+	return next, nil
+}
+
 func TestOptimizelyAPIClient_sendPaginatedAPIRequest(t *testing.T) {
 	type mockApiResponse struct {
 		requestURL string
@@ -162,12 +230,14 @@ func TestOptimizelyAPIClient_sendPaginatedAPIRequest(t *testing.T) {
 		err        error
 	}
 	tests := []struct {
-		name      string
-		responses []mockApiResponse
-		expectErr bool
+		name       string
+		pagination PaginationStrategy
+		responses  []mockApiResponse
+		expectErr  bool
 	}{
 		{
 			"multiple api pages are requested and all responses returned",
+			nil,
 			[]mockApiResponse{
 				{
 					"https://fake.url",
@@ -192,8 +262,46 @@ func TestOptimizelyAPIClient_sendPaginatedAPIRequest(t *testing.T) {
 				},
 			},
 			false,
+		}, {
+			"custom pagination strategy is used to find next page",
+			nextPageHeaderPagination{},
+			[]mockApiResponse{
+				{
+					"https://fake.url",
+					&http.Response{
+						StatusCode: http.StatusOK,
+						Header: http.Header{
+							"Link":        []string{"<https://fake.url?page=3>; rel=\"next\""},
+							"X-Next-Page": []string{"https://fake.url?page=2"},
+						},
+					},
+					nil,
+				}, {
+					"https://fake.url?page=2",
+					&http.Response{
+						StatusCode: http.StatusOK,
+					},
+					nil,
+				},
+			},
+			false,
+		}, {
+			"error from pagination strategy returns error",
+			nextPageHeaderPagination{},
+			[]mockApiResponse{
+				{
+					"https://fake.url",
+					&http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"X-Next-Page": []string{"invalid"}},
+					},
+					nil,
+				},
+			},
+			true,
 		}, {
 			"error with one response returns error",
+			nil,
 			[]mockApiResponse{
 				{
 					"https://fake.url",
@@ -218,11 +326,12 @@ func TestOptimizelyAPIClient_sendPaginatedAPIRequest(t *testing.T) {
 			for _, resp := range test.responses {
 				req, err := http.NewRequest(http.MethodGet, resp.requestURL, nil)
 				require.NoError(t, err)
+				req.Header.Set("User-Agent", defaultUserAgent)
 				mt.On("RoundTrip", req).Return(resp.response, resp.err).Once()
 				expectedResponses = append(expectedResponses, resp.response)
 			}
 			defer mt.AssertExpectations(t)
-			client := optimizelyAPIClient{Client: http.Client{Transport: mt}}
+			client := optimizelyAPIClient{Client: http.Client{Transport: mt}, pagination: test.pagination}
 			responses, err := client.sendPaginatedAPIRequest(http.MethodGet, test.responses[0].requestURL, nil, nil, nil)
 			if test.expectErr {
 				assert.Error(t, err)
@@ -233,3 +342,133 @@ func TestOptimizelyAPIClient_sendPaginatedAPIRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestOptimizelyAPIClient_sendPaginatedAPIRequest_perPage(t *testing.T) {
+	mt := &mockTransport{}
+	mt.On("RoundTrip", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK}, nil).Once()
+	defer mt.AssertExpectations(t)
+	client := optimizelyAPIClient{Client: http.Client{Transport: mt}, perPage: 5}
+	query := url.Values{"query": []string{"abc"}}
+	_, err := client.sendPaginatedAPIRequest(http.MethodGet, "https://fake.url", nil, query, nil)
+	require.NoError(t, err)
+	sentRequest := mt.Calls[0].Arguments[0].(*http.Request)
+	requestedPerPage, err := strconv.Atoi(sentRequest.URL.Query().Get("per_page"))
+	require.NoError(t, err)
+	assert.Equal(t, client.perPage, requestedPerPage)
+	assert.Equal(t, "abc", sentRequest.URL.Query().Get("query"))
+	// the caller's query is not modified
+	assert.Equal(t, url.Values{"query": []string{"abc"}}, query)
+}
+
+func TestOptimizelyAPIClient_sendPaginatedAPIRequest_perPageOverride(t *testing.T) {
+	mt := &mockTransport{}
+	mt.On("RoundTrip", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK}, nil).Once()
+	defer mt.AssertExpectations(t)
+	client := optimizelyAPIClient{Client: http.Client{Transport: mt}, perPage: 5}
+	query := url.Values{"per_page": []string{"50"}}
+	_, err := client.sendPaginatedAPIRequest(http.MethodGet, "https://fake.url", nil, query, nil)
+	require.NoError(t, err)
+	sentRequest := mt.Calls[0].Arguments[0].(*http.Request)
+	assert.Equal(t, "50", sentRequest.URL.Query().Get("per_page"))
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected RateLimit
+		ok       bool
+	}{
+		{
+			"all headers are parsed",
+			http.Header{
+				"X-Ratelimit-Limit":     []string{"50"},
+				"X-Ratelimit-Remaining": []string{"42"},
+				"X-Ratelimit-Reset":     []string{"30"},
+			},
+			RateLimit{Limit: 50, Remaining: 42, Reset: 30 * time.Second},
+			true,
+		},
+		{
+			"limit and reset are optional",
+			http.Header{"X-Ratelimit-Remaining": []string{"0"}},
+			RateLimit{},
+			true,
+		},
+		{
+			"malformed optional headers are ignored",
+			http.Header{
+				"X-Ratelimit-Limit":     []string{"lots"},
+				"X-Ratelimit-Remaining": []string{"7"},
+				"X-Ratelimit-Reset":     []string{"soon"},
+			},
+			RateLimit{Remaining: 7},
+			true,
+		},
+		{"missing remaining header", http.Header{"X-Ratelimit-Limit": []string{"50"}}, RateLimit{}, false},
+		{"malformed remaining header", http.Header{"X-Ratelimit-Remaining": []string{"some"}}, RateLimit{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl, ok := parseRateLimit(test.header)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, rl)
+		})
+	}
+}
+
+func TestOptimizelyAPIClient_sendAPIRequest_rateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    *http.Response
+		expected    []RateLimit
+		expectedErr bool
+	}{
+		{
+			"rate limit is reported for successful responses",
+			&http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"X-Ratelimit-Remaining": []string{"9"}, "X-Ratelimit-Reset": []string{"60"}},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			},
+			[]RateLimit{{Remaining: 9, Reset: time.Minute}},
+			false,
+		},
+		{
+			"rate limit is reported for rate limited responses",
+			&http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"5"}},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			},
+			[]RateLimit{{Remaining: 0, Reset: 5 * time.Second}},
+			true,
+		},
+		{
+			"responses without rate limit headers are ignored",
+			&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))},
+			[]RateLimit{},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mt := &mockTransport{}
+			mt.On("RoundTrip", mock.Anything).Return(test.response, nil).Once()
+			defer mt.AssertExpectations(t)
+			reported := make([]RateLimit, 0)
+			c := NewClient(OnRateLimit(func(rl RateLimit) {
+				reported = append(reported, rl)
+			})).(client)
+			ac := c.apiClient.(optimizelyAPIClient)
+			ac.Transport = mt
+			_, err := ac.sendAPIRequest(http.MethodGet, "https://fake.url", nil, nil, nil)
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, reported)
+		})
+	}
+}
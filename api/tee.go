@@ -0,0 +1,149 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// tee is a Client that reports events to several clients at once. All other requests are handled
+// by the primary client, which is embedded.
+type tee struct {
+	Client
+	secondaries      []Client
+	onSecondaryError func(error)
+}
+
+// TeeError is returned when events reported with a client created by Tee could not be reported to
+// at least one of its clients.
+type TeeError struct {
+	// Primary is the error returned by the primary client, if any.
+	Primary error
+	// Secondaries holds the error returned by each secondary client, in the order of the clients
+	// passed to Tee. Clients that reported the events successfully have a nil error.
+	Secondaries []error
+}
+
+func (e TeeError) Error() string {
+	messages := make([]string, 0, len(e.Secondaries)+1)
+	if e.Primary != nil {
+		messages = append(messages, fmt.Sprintf("primary: %v", e.Primary))
+	}
+	for i, err := range e.Secondaries {
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("secondary %d: %v", i, err))
+		}
+	}
+	return fmt.Sprintf("error reporting events: %s", strings.Join(messages, "; "))
+}
+
+// Unwrap returns the error of the primary client.
+func (e TeeError) Unwrap() error {
+	return e.Primary
+}
+
+// Is reports whether the error of any secondary client matches the target. The error of the
+// primary client is matched through Unwrap.
+func (e TeeError) Is(target error) bool {
+	for _, err := range e.Secondaries {
+		if err != nil && xerrors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches the target, checking the error of the primary client before
+// the errors of the secondary clients.
+func (e TeeError) As(target interface{}) bool {
+	if e.Primary != nil && xerrors.As(e.Primary, target) {
+		return true
+	}
+	for _, err := range e.Secondaries {
+		if err != nil && xerrors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tee creates a Client that reports events to the primary client and every secondary client in
+// parallel, e.g. to send events to both Optimizely and an internal analytics pipeline. Only the
+// events methods are fanned out; every other method is handled by the primary client. By default,
+// a TeeError is returned if reporting to any client fails.
+//
+// Callers that retry failed deliveries, such as ReportEventsWithRetry and Reporter, resend the events
+// to every client when only a secondary client failed, duplicating them in the primary client. Use
+// SecondaryErrorHandler to make the primary client authoritative instead. Note that when the primary
+// client fails and the events are retried, secondary clients that succeeded receive the events again,
+// with the same event UUIDs.
+func Tee(primary Client, secondaries []Client, options ...func(*tee)) Client {
+	t := &tee{Client: primary, secondaries: secondaries}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+// SecondaryErrorHandler makes a client created by Tee pass errors from its secondary clients to the
+// given handler, e.g. to count them in a metric, as an option to Tee. The primary client is then
+// authoritative: only its error, if any, is returned from the events methods.
+func SecondaryErrorHandler(handler func(error)) func(*tee) {
+	return func(t *tee) {
+		t.onSecondaryError = handler
+	}
+}
+
+// ReportEvents sends serialized events to the primary and secondary clients.
+func (t *tee) ReportEvents(events []byte) error {
+	return t.ReportEventsForRegion("", events)
+}
+
+// ReportEventsForRegion sends serialized events for the given region to the primary and secondary
+// clients.
+func (t *tee) ReportEventsForRegion(region string, events []byte) error {
+	var wg sync.WaitGroup
+	secondaryErrs := make([]error, len(t.secondaries))
+	wg.Add(len(t.secondaries))
+	for i, secondary := range t.secondaries {
+		go func(i int, secondary Client) {
+			defer wg.Done()
+			secondaryErrs[i] = secondary.ReportEventsForRegion(region, events)
+		}(i, secondary)
+	}
+	primaryErr := t.Client.ReportEventsForRegion(region, events)
+	wg.Wait()
+
+	if t.onSecondaryError != nil {
+		for _, err := range secondaryErrs {
+			if err != nil {
+				t.onSecondaryError(err)
+			}
+		}
+		return primaryErr
+	}
+	failed := primaryErr != nil
+	for _, err := range secondaryErrs {
+		failed = failed || err != nil
+	}
+	if !failed {
+		return nil
+	}
+	return TeeError{Primary: primaryErr, Secondaries: secondaryErrs}
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+// capturingClient records the events reported to it and returns the configured error
+type capturingClient struct {
+	Client
+	err     error
+	mutex   sync.Mutex
+	regions []string
+	events  [][]byte
+}
+
+func (c *capturingClient) ReportEvents(events []byte) error {
+	return c.ReportEventsForRegion("", events)
+}
+
+func (c *capturingClient) ReportEventsForRegion(region string, events []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.regions = append(c.regions, region)
+	c.events = append(c.events, events)
+	return c.err
+}
+
+func TestTee(t *testing.T) {
+	primaryErr := fmt.Errorf("primary error")
+	secondaryErr := fmt.Errorf("secondary error")
+	tests := []struct {
+		name               string
+		primaryErr         error
+		secondaryErr       error
+		handleSecondaryErr bool
+		expectedErr        error
+		expectedHandled    []error
+	}{
+		{"all clients succeed", nil, nil, false, nil, []error{}},
+		{
+			"errors are aggregated",
+			primaryErr,
+			secondaryErr,
+			false,
+			TeeError{Primary: primaryErr, Secondaries: []error{nil, secondaryErr}},
+			[]error{},
+		}, {
+			"secondary error is returned without a handler",
+			nil,
+			secondaryErr,
+			false,
+			TeeError{Secondaries: []error{nil, secondaryErr}},
+			[]error{},
+		}, {
+			"primary is authoritative with a handler",
+			nil,
+			secondaryErr,
+			true,
+			nil,
+			[]error{secondaryErr},
+		}, {
+			"primary error is returned with a handler",
+			primaryErr,
+			secondaryErr,
+			true,
+			primaryErr,
+			[]error{secondaryErr},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			primary := &capturingClient{err: test.primaryErr}
+			lake := &capturingClient{}
+			failing := &capturingClient{err: test.secondaryErr}
+			handled := make([]error, 0)
+			options := []func(*tee){}
+			if test.handleSecondaryErr {
+				options = append(options, SecondaryErrorHandler(func(err error) { handled = append(handled, err) }))
+			}
+			c := Tee(primary, []Client{lake, failing}, options...)
+
+			err := c.ReportEventsForRegion(RegionEU, []byte(`{"events": true}`))
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expectedHandled, handled)
+			for _, client := range []*capturingClient{primary, lake, failing} {
+				assert.Equal(t, [][]byte{[]byte(`{"events": true}`)}, client.events)
+				assert.Equal(t, []string{RegionEU}, client.regions)
+			}
+		})
+	}
+}
+
+func TestTeeError(t *testing.T) {
+	primaryErr := fmt.Errorf("primary error")
+	secondaryErr := &EventsStatusError{StatusCode: 400}
+	err := TeeError{Primary: primaryErr, Secondaries: []error{nil, secondaryErr}}
+	assert.Equal(t, "error reporting events: primary: primary error; "+
+		"secondary 1: unexpected status code (400) received from events API", err.Error())
+	assert.True(t, xerrors.Is(err, primaryErr))
+	assert.True(t, xerrors.Is(err, secondaryErr))
+	assert.False(t, xerrors.Is(err, fmt.Errorf("other error")))
+	var statusErr *EventsStatusError
+	assert.True(t, xerrors.As(err, &statusErr))
+	assert.Equal(t, secondaryErr, statusErr)
+}
+
+func TestTee_ReportEvents(t *testing.T) {
+	primary := &capturingClient{}
+	secondary := &capturingClient{}
+	assert.NoError(t, Tee(primary, []Client{secondary}).ReportEvents([]byte(`{}`)))
+	assert.Equal(t, []string{""}, primary.regions)
+	assert.Equal(t, []string{""}, secondary.regions)
+}
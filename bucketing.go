@@ -16,8 +16,9 @@ package optimizely
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
 	"math"
+	"sort"
 	"time"
 
 	"github.com/spaolacci/murmur3"
@@ -26,6 +27,15 @@ import (
 // status of an experiment that is in the running state
 const runningStatus = "Running"
 
+// statuses of experiments in Optimizely datafiles; only running experiments are bucketed
+var knownStatuses = map[string]bool{
+	runningStatus: true,
+	"Paused":      true,
+	"Not started": true,
+	"Archived":    true,
+	"Launched":    true,
+}
+
 // max value of a traffic allocation; used as an upper bound for the bucketing hash
 const maxTrafficValue = 10000
 
@@ -41,19 +51,121 @@ type Impression struct {
 	Timestamp time.Time
 }
 
+// Revision returns the revision of the datafile that the impression was generated from.
+func (i Impression) Revision() string {
+	return i.owner().project.Revision
+}
+
+// owner returns the experiment of the variation, whose project is never nil. Variations created
+// outside of a project, e.g. by a mock Bucketer, belong to an empty experiment of an empty project.
+func (v Variation) owner() *Experiment {
+	if v.experiment == nil {
+		return &Experiment{project: &Project{}}
+	}
+	if v.experiment.project == nil {
+		experiment := *v.experiment
+		experiment.project = &Project{}
+		return &experiment
+	}
+	return v.experiment
+}
+
+// impressionJSON is the serialized form of an Impression. It holds everything from the experiment
+// and project of the impression that is needed to report it.
+type impressionJSON struct {
+	AccountID     string    `json:"accountId"`
+	Revision      string    `json:"revision"`
+	Region        string    `json:"region,omitempty"`
+	ExperimentID  string    `json:"experimentId"`
+	ExperimentKey string    `json:"experimentKey"`
+	LayerID       string    `json:"layerId"`
+	VariationID   string    `json:"variationId"`
+	VariationKey  string    `json:"variationKey"`
+	UserID        string    `json:"userId"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// MarshalJSON serializes the impression so that it can be stored or sent to another process and
+// later reported with ActivatedImpression after being deserialized with UnmarshalJSON.
+func (i Impression) MarshalJSON() ([]byte, error) {
+	ij := impressionJSON{
+		VariationID:  i.id,
+		VariationKey: i.Key,
+		UserID:       i.UserID,
+		Timestamp:    i.Timestamp,
+	}
+	if i.experiment != nil {
+		ij.ExperimentID = i.experiment.id
+		ij.ExperimentKey = i.experiment.Key
+		ij.LayerID = i.experiment.layerID
+		if i.experiment.project != nil {
+			ij.AccountID = i.experiment.project.AccountID
+			ij.Revision = i.experiment.project.Revision
+			ij.Region = i.experiment.project.Region
+		}
+	}
+	return json.Marshal(ij)
+}
+
+// UnmarshalJSON deserializes an impression serialized with MarshalJSON. The experiment and project
+// of the deserialized impression only hold what is needed to report it, so it cannot be used to
+// look up the experiment's other variations or the project's other experiments.
+func (i *Impression) UnmarshalJSON(data []byte) error {
+	ij := impressionJSON{}
+	if err := json.Unmarshal(data, &ij); err != nil {
+		return err
+	}
+	project := &Project{AccountID: ij.AccountID, Revision: ij.Revision, Region: ij.Region}
+	experiment := &Experiment{id: ij.ExperimentID, Key: ij.ExperimentKey, layerID: ij.LayerID, project: project}
+	*i = Impression{
+		Variation: Variation{id: ij.VariationID, Key: ij.VariationKey, experiment: experiment},
+		UserID:    ij.UserID,
+		Timestamp: ij.Timestamp,
+	}
+	return nil
+}
+
 // GetVariation returns an impression, if applicable, for a given experiment
 // and a given user id. If no variation is applicable, nil is returned. The
 // Impression returned by this method can be used later to generate events
 // for reporting to the Optimizely API.
 func (p Project) GetVariation(experimentName, userID string) *Impression {
+	return p.GetVariationAt(experimentName, userID, time.Now())
+}
+
+// GetVariationAt is like GetVariation but stamps the returned impression with the given time
+// instead of the current time. This is useful for backfilling or replaying historical events,
+// where the impression must carry the time at which the user originally saw the experiment.
+func (p Project) GetVariationAt(experimentName, userID string, timestamp time.Time) *Impression {
+	return p.getVariation(experimentName, userID, userID, timestamp)
+}
+
+// getVariation returns an impression of the experiment for the user stamped with the given time, if
+// applicable, bucketing the user by the given bucketing ID.
+func (p Project) getVariation(experimentName, userID, bucketingID string, timestamp time.Time) *Impression {
+	if p.onUnknownExperiment != nil && !p.knownExperiments[experimentName] {
+		p.onUnknownExperiment(experimentName)
+		return nil
+	}
 	experiment, ok := p.experiments[experimentName]
 	if !ok {
 		return nil
 	}
+	return p.decide(experiment, userID, bucketingID, timestamp)
+}
+
+// decide returns an impression of the experiment for the user stamped with the given time, if
+// applicable. Forced variations and previous decisions are looked up by the user ID, while users
+// that have not been decided yet are bucketed by the bucketing ID. Unlike getVariation, the
+// experiment is not checked against the known experiments of strict mode, since it may have been
+// resolved by the project, e.g. from a feature, rather than by the caller.
+func (p Project) decide(experiment Experiment, userID, bucketingID string, timestamp time.Time) *Impression {
 	if experiment.status != runningStatus {
+		if p.onUnknownStatus != nil && !knownStatuses[experiment.status] {
+			p.onUnknownStatus(experiment.Key, experiment.status)
+		}
 		return nil
 	}
-	timestamp := time.Now()
 	forcedVariation, ok := experiment.forcedVariations[userID]
 	if ok {
 		return &Impression{
@@ -72,7 +184,30 @@ func (p Project) GetVariation(experimentName, userID string) *Impression {
 			Timestamp: timestamp,
 		}
 	}
-	variation := experiment.findBucket(experiment.getBucketValue(userID))
+	// a decision recorded in the store takes precedence over bucketing so that users keep their
+	// variation after the traffic allocation changes
+	if storedVariation, ok := p.storedVariation(experiment, userID); ok {
+		experiment.mutex.Lock()
+		defer experiment.mutex.Unlock()
+		experiment.cachedVariations[userID] = storedVariation
+		return &Impression{
+			Variation: storedVariation,
+			UserID:    userID,
+			Timestamp: timestamp,
+		}
+	}
+	// users bucketed into another experiment of the group or into the group's holdback
+	// do not see this experiment
+	if experiment.group != nil &&
+		experiment.group.findExperiment(p.getBucketValue(bucketingID, experiment.group.id)) != experiment.id {
+		return nil
+	}
+	variation := p.bucket(experiment, bucketingID)
+	// users bucketed outside of the experiment's traffic allocation do not see the experiment
+	if variation == nil {
+		return nil
+	}
+	p.storeVariation(experiment, userID, *variation)
 	experiment.mutex.Lock()
 	defer experiment.mutex.Unlock()
 	experiment.cachedVariations[userID] = *variation
@@ -83,23 +218,174 @@ func (p Project) GetVariation(experimentName, userID string) *Impression {
 	}
 }
 
-// getBucketValue finds the value of the bucket given a unique ID (should be the user ID)
-// using the murmur hash algorithm.
-func (e Experiment) getBucketValue(bucketingID string) int {
-	bucketingKey := fmt.Sprintf("%v%v", bucketingID, e.id)
-	hashCode := murmur3.Sum32WithSeed([]byte(bucketingKey), hashSeed)
-	ratio := float64(hashCode) / math.MaxUint32
-	return int(math.Floor(ratio * maxTrafficValue))
+// IsForced returns the key of the variation that the user is forced into by the forced variations
+// of the experiment in the datafile, if any. Like GetVariation, forced variations only apply to running
+// experiments. Unlike GetVariation, no impression is created and the user is not bucketed or cached,
+// which makes this suitable for introspection, e.g. to show which users are pinned to a variation.
+func (p Project) IsForced(experimentKey, userID string) (string, bool) {
+	experiment, ok := p.experiments[experimentKey]
+	if !ok || experiment.status != runningStatus {
+		return "", false
+	}
+	variation, ok := experiment.forcedVariations[userID]
+	if !ok {
+		return "", false
+	}
+	return variation.Key, true
+}
+
+// getOverriddenVariation returns an impression of the variation with the given key for the given
+// experiment and user ID. If the experiment is not running or the variation does not exist, nil is returned.
+func (p Project) getOverriddenVariation(experimentName, variationKey, userID string) *Impression {
+	experiment, ok := p.experiments[experimentName]
+	if !ok || experiment.status != runningStatus {
+		return nil
+	}
+	variation, ok := experiment.variations[variationKey]
+	if !ok {
+		return nil
+	}
+	return &Impression{
+		Variation: variation,
+		UserID:    userID,
+		Timestamp: time.Now(),
+	}
+}
+
+// bucket returns the variation of the experiment that the user is bucketed into, or nil if the user
+// is outside of the experiment's traffic allocation.
+func (p Project) bucket(experiment Experiment, userID string) *Variation {
+	// experiments that allocate all traffic to a single variation, e.g. launched experiments, have the
+	// same outcome for every bucket, so the hash can be skipped
+	if variation := experiment.fullAllocation(p.maxBucketValue()); variation != nil {
+		return variation
+	}
+	return experiment.findBucket(p.getBucketValue(userID, p.bucketingEntityID(experiment)))
+}
+
+// fullAllocation returns the variation of the experiment if its traffic allocation has a single
+// variation covering every bucket below max, or nil otherwise.
+func (e Experiment) fullAllocation(max int) *Variation {
+	if len(e.trafficAllocation) != 1 || e.trafficAllocation[0].endOfRange < max {
+		return nil
+	}
+	return &e.trafficAllocation[0].Variation
+}
+
+// getBucketValue finds the value of the bucket, from 0 up to but not including the project's max bucket
+// value, given a unique ID (should be the user ID) and the ID of the entity being bucketed into (an
+// experiment or a group) using the project's bucketing key and the murmur hash algorithm.
+func (p Project) getBucketValue(bucketingID, entityID string) int {
+	return bucketValue(p.bucketingKey(bucketingID, entityID), p.maxBucketValue())
+}
+
+// getBucketValue finds the value of the bucket, from 0 up to but not including max, given a unique
+// ID (should be the user ID) using the default bucketing key and the murmur hash algorithm.
+func (e Experiment) getBucketValue(bucketingID string, max int) int {
+	return bucketValue(DefaultBucketingKey(bucketingID, e.id), max)
+}
+
+// bucketValue finds the value of the bucket, from 0 up to but not including max, of a bucketing key.
+func bucketValue(bucketingKey string, max int) int {
+	ratio := float64(getHashCode(bucketingKey)) / math.MaxUint32
+	return int(math.Floor(ratio * float64(max)))
+}
+
+// DefaultBucketingKey composes the key that is hashed to bucket a unique ID, usually the user ID, into
+// an entity, i.e. an experiment or a group, the way all Optimizely SDKs do: the unique ID followed by
+// the entity ID.
+func DefaultBucketingKey(bucketingID, entityID string) string {
+	return bucketingID + entityID
+}
+
+// getHashCode returns the raw 32-bit murmur hash of a bucketing key. This is the value that all
+// Optimizely SDKs derive bucket values from, so it is useful for verifying parity with other SDKs.
+func getHashCode(bucketingKey string) uint32 {
+	return murmur3.Sum32WithSeed([]byte(bucketingKey), hashSeed)
+}
+
+// VariationForBucket returns the variation of the experiment's traffic allocation that contains
+// the given bucket value, from 0 up to but not including the max traffic value of the project, which
+// is 10000 unless changed with SetMaxTrafficValue, or nil if the bucket value is not allocated to any
+// variation. A bucket value equal to the end of a range belongs to the next range.
+// This is intended for analyzing traffic allocations; use GetVariation to bucket users.
+func (e Experiment) VariationForBucket(bucketValue int) *Variation {
+	variation := e.findBucket(bucketValue)
+	if variation == nil {
+		return nil
+	}
+	// return a copy so that the experiment cannot be modified through the result
+	v := *variation
+	return &v
 }
 
 // findBucket finds the variation from the experiment's traffic allocation given a bucketing value.
 func (e Experiment) findBucket(bucketValue int) *Variation {
-	for _, allocation := range e.trafficAllocation {
+	// allocations are sorted by end of range, so the bucket is the first allocation
+	// whose range ends after the bucket value
+	i := sort.Search(len(e.trafficAllocation), func(i int) bool {
+		return bucketValue < e.trafficAllocation[i].endOfRange
+	})
+	if i == len(e.trafficAllocation) {
+		return nil
+	}
+	return &e.trafficAllocation[i].Variation
+}
+
+// findExperiment finds the ID of the experiment from the group's traffic allocation given a
+// bucketing value. An empty ID is returned if the bucketing value falls into the group's holdback.
+func (g group) findExperiment(bucketValue int) string {
+	for _, allocation := range g.trafficAllocation {
 		if bucketValue < allocation.endOfRange {
-			return &allocation.Variation
+			return allocation.experimentID
 		}
 	}
-	return nil
+	return ""
+}
+
+// IsForced returns the key of the variation that the user stored in the context is forced into for
+// the given experiment, either by the overrides of WithForcedVariations or by the forced variations of
+// the datafile, if any. Overrides take precedence, as in GetVariation. No impression is recorded in the
+// context. See Project.IsForced for more details.
+func IsForced(ctx context.Context, experimentKey string) (string, bool) {
+	projectCtx, ok := ctx.Value(projCtxKey).(*projectContext)
+	if !ok {
+		return "", false
+	}
+	if overrides, ok := ctx.Value(overridesCtxKey).(map[string]string); ok {
+		if variationKey, ok := overrides[experimentKey]; ok {
+			if impression := projectCtx.getOverriddenVariation(experimentKey, variationKey, projectCtx.userID); impression != nil {
+				return impression.Key, true
+			}
+		}
+	}
+	return projectCtx.IsForced(experimentKey, projectCtx.userID)
+}
+
+// ForcedVariationsFromContext returns the forced variations of the experiment with the given key in
+// the project stored in the context, like Experiment.ForcedVariations, including the runtime override
+// of the experiment for the user of the context set with WithForcedVariations. The override takes
+// precedence over the forced variation of the user in the datafile, if any, and like with
+// GetVariation, it only applies to running experiments and is ignored for unknown variations. Nil is
+// returned if no project was found in the context or the project has no experiment with the key.
+func ForcedVariationsFromContext(ctx context.Context, experimentKey string) map[string]string {
+	projectCtx, ok := ctx.Value(projCtxKey).(*projectContext)
+	if !ok {
+		return nil
+	}
+	experiment, ok := projectCtx.experiments[experimentKey]
+	if !ok {
+		return nil
+	}
+	forcedVariations := experiment.ForcedVariations()
+	if overrides, ok := ctx.Value(overridesCtxKey).(map[string]string); ok {
+		if variationKey, ok := overrides[experimentKey]; ok {
+			if impression := projectCtx.getOverriddenVariation(experimentKey, variationKey, projectCtx.userID); impression != nil {
+				forcedVariations[projectCtx.userID] = impression.Key
+			}
+		}
+	}
+	return forcedVariations
 }
 
 // GetVariation returns the variation, if applicable, for the given experiment
@@ -110,10 +396,19 @@ func GetVariation(ctx context.Context, experimentName string) Variation {
 	if !ok {
 		return Variation{}
 	}
-	impression := projectCtx.GetVariation(experimentName, projectCtx.userID)
+	var impression *Impression
+	if overrides, ok := ctx.Value(overridesCtxKey).(map[string]string); ok {
+		if variationKey, ok := overrides[experimentName]; ok {
+			impression = projectCtx.getOverriddenVariation(experimentName, variationKey, projectCtx.userID)
+		}
+	}
+	if impression == nil {
+		impression = projectCtx.getVariation(experimentName)
+	}
 	if impression == nil {
 		return Variation{}
 	}
+	// the experiment's lock taken while bucketing has been released, so only the context's lock is held here
 	projectCtx.mutex.Lock()
 	defer projectCtx.mutex.Unlock()
 	projectCtx.impressions = append(projectCtx.impressions, *impression)
@@ -18,10 +18,12 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestExperiment_getBucketValue(t *testing.T) {
@@ -55,7 +57,24 @@ func TestExperiment_getBucketValue(t *testing.T) {
 	for _, test := range tests {
 		testName := fmt.Sprintf("experiment id %v, bucketing id %v", test.experimentID, test.bucketingID)
 		t.Run(testName, func(t *testing.T) {
-			assert.Equal(t, test.expectedValue, Experiment{id: test.experimentID}.getBucketValue(test.bucketingID))
+			assert.Equal(t, test.expectedValue, Experiment{id: test.experimentID}.getBucketValue(test.bucketingID, maxTrafficValue))
+		})
+	}
+}
+
+func TestGetHashCode(t *testing.T) {
+	tests := []struct {
+		bucketingID, entityID string
+		expectedHash          uint32
+	}{
+		{"ppid1", "1886780721", 2256854705},
+		{"ppid2", "1886780722", 1045634806},
+		{"", "", 0x514e28b7},
+	}
+	for _, test := range tests {
+		testName := fmt.Sprintf("bucketing id %v, entity id %v", test.bucketingID, test.entityID)
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, test.expectedHash, getHashCode(DefaultBucketingKey(test.bucketingID, test.entityID)))
 		})
 	}
 }
@@ -101,6 +120,144 @@ func TestExperiment_findBucket(t *testing.T) {
 	}
 }
 
+func TestExperiment_VariationForBucket(t *testing.T) {
+	a := Variation{id: "a", Key: "a"}
+	b := Variation{id: "b", Key: "b"}
+	experiment := Experiment{trafficAllocation: []trafficAllocation{
+		{endOfRange: 4000, Variation: a},
+		{endOfRange: 10000, Variation: b},
+	}}
+	assert.Equal(t, &a, experiment.VariationForBucket(0))
+	assert.Equal(t, &a, experiment.VariationForBucket(3999))
+	assert.Equal(t, &b, experiment.VariationForBucket(4000))
+	assert.Equal(t, &b, experiment.VariationForBucket(9999))
+	assert.Nil(t, experiment.VariationForBucket(10000))
+	// the experiment cannot be modified through the returned variation
+	experiment.VariationForBucket(0).Key = "changed"
+	assert.Equal(t, "a", experiment.trafficAllocation[0].Variation.Key)
+}
+
+// findBucketLinear is the linear scan that findBucket replaced, kept to check that
+// the binary search selects the same buckets and to benchmark against.
+func (e Experiment) findBucketLinear(bucketValue int) *Variation {
+	for _, allocation := range e.trafficAllocation {
+		if bucketValue < allocation.endOfRange {
+			return &allocation.Variation
+		}
+	}
+	return nil
+}
+
+// experimentWithAllocations returns an experiment whose traffic is split evenly across n
+// variations, with a gap of unallocated traffic at the end.
+func experimentWithAllocations(n int) Experiment {
+	allocations := make([]trafficAllocation, 0, n)
+	for i := 1; i <= n; i++ {
+		key := fmt.Sprintf("variation_%d", i)
+		allocations = append(allocations, trafficAllocation{
+			endOfRange: i * (maxTrafficValue - 100) / n,
+			Variation:  Variation{id: key, Key: key},
+		})
+	}
+	return Experiment{trafficAllocation: allocations}
+}
+
+func TestExperiment_findBucket_matchesLinearScan(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 5, 64} {
+		experiment := experimentWithAllocations(n)
+		for bucketValue := 0; bucketValue < maxTrafficValue; bucketValue++ {
+			require.Equal(
+				t, experiment.findBucketLinear(bucketValue), experiment.findBucket(bucketValue),
+				"%d allocations, bucket value %d", n, bucketValue)
+		}
+	}
+}
+
+func BenchmarkExperiment_findBucket(b *testing.B) {
+	for _, n := range []int{2, 16, 64} {
+		experiment := experimentWithAllocations(n)
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				experiment.findBucketLinear(i % maxTrafficValue)
+			}
+		})
+		b.Run(fmt.Sprintf("binary/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				experiment.findBucket(i % maxTrafficValue)
+			}
+		})
+	}
+}
+
+func TestProject_bucket(t *testing.T) {
+	launched := Experiment{
+		id:                "1",
+		trafficAllocation: []trafficAllocation{{endOfRange: maxTrafficValue, Variation: Variation{id: "a", Key: "a"}}},
+	}
+	tests := []struct {
+		name           string
+		experiment     Experiment
+		maxTraffic     int
+		shortCircuited bool
+	}{
+		{"launched", launched, 0, true},
+		{
+			"single partially allocated variation",
+			Experiment{id: "1", trafficAllocation: []trafficAllocation{{endOfRange: 5000, Variation: Variation{id: "a", Key: "a"}}}},
+			0,
+			false,
+		},
+		{"split", experimentWithAllocations(2), 0, false},
+		{"launched with a larger max traffic value", launched, 1000000, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Project{maxTraffic: test.maxTraffic}
+			assert.Equal(t, test.shortCircuited, test.experiment.fullAllocation(p.maxBucketValue()) != nil)
+			for i := 0; i < 1000; i++ {
+				userID := fmt.Sprintf("user_%d", i)
+				expected := test.experiment.findBucket(p.getBucketValue(userID, test.experiment.id))
+				assert.Equal(t, expected, p.bucket(test.experiment, userID))
+			}
+		})
+	}
+}
+
+func BenchmarkProject_bucket(b *testing.B) {
+	benchmarks := []struct {
+		name       string
+		experiment Experiment
+	}{
+		{
+			"launched",
+			Experiment{
+				id:                "1",
+				trafficAllocation: []trafficAllocation{{endOfRange: maxTrafficValue, Variation: Variation{id: "a", Key: "a"}}},
+			},
+		},
+		{"split", experimentWithAllocations(2)},
+	}
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			p := Project{}
+			for i := 0; i < b.N; i++ {
+				p.bucket(benchmark.experiment, "user")
+			}
+		})
+	}
+}
+
+func TestGroup_findExperiment(t *testing.T) {
+	g := group{trafficAllocation: []groupAllocation{
+		{endOfRange: 3000, experimentID: "a"},
+		{endOfRange: 6000, experimentID: ""},
+		{endOfRange: 10000, experimentID: "b"},
+	}}
+	assert.Equal(t, "a", g.findExperiment(0))
+	assert.Equal(t, "", g.findExperiment(3000))
+	assert.Equal(t, "b", g.findExperiment(9999))
+}
+
 func TestProject_GetVariation(t *testing.T) {
 	tests := []struct {
 		name                   string
@@ -157,6 +314,95 @@ func TestProject_GetVariation(t *testing.T) {
 			"user",
 			&Impression{Variation: Variation{id: "abc", Key: "abc"}, UserID: "user"},
 			true,
+		}, {
+			"user outside of a gapped traffic allocation returns nil",
+			Project{experiments: map[string]Experiment{
+				"a": {
+					// ppid1 is in bucket 5254
+					id:               "1886780721",
+					status:           runningStatus,
+					forcedVariations: map[string]Variation{},
+					trafficAllocation: []trafficAllocation{
+						{endOfRange: 3000, Variation: Variation{id: "abc", Key: "abc"}},
+						{endOfRange: 5000, Variation: Variation{id: "def", Key: "def"}},
+					},
+					cachedVariations: map[string]Variation{},
+					mutex:            &sync.RWMutex{},
+				},
+			}},
+			"a",
+			"ppid1",
+			nil,
+			false,
+		}, {
+			"user in group holdback returns nil",
+			Project{experiments: map[string]Experiment{
+				"a": {
+					id:               "a_id",
+					status:           runningStatus,
+					forcedVariations: map[string]Variation{},
+					trafficAllocation: []trafficAllocation{{
+						endOfRange: maxTrafficValue,
+						Variation:  Variation{id: "abc", Key: "abc"},
+					}},
+					cachedVariations: map[string]Variation{},
+					mutex:            &sync.RWMutex{},
+					group: &group{
+						id:                "group",
+						trafficAllocation: []groupAllocation{{endOfRange: maxTrafficValue, experimentID: ""}},
+					},
+				},
+			}},
+			"a",
+			"user",
+			nil,
+			false,
+		}, {
+			"user bucketed into another experiment of the group returns nil",
+			Project{experiments: map[string]Experiment{
+				"a": {
+					id:               "a_id",
+					status:           runningStatus,
+					forcedVariations: map[string]Variation{},
+					trafficAllocation: []trafficAllocation{{
+						endOfRange: maxTrafficValue,
+						Variation:  Variation{id: "abc", Key: "abc"},
+					}},
+					cachedVariations: map[string]Variation{},
+					mutex:            &sync.RWMutex{},
+					group: &group{
+						id:                "group",
+						trafficAllocation: []groupAllocation{{endOfRange: maxTrafficValue, experimentID: "b_id"}},
+					},
+				},
+			}},
+			"a",
+			"user",
+			nil,
+			false,
+		}, {
+			"user bucketed into experiment of the group",
+			Project{experiments: map[string]Experiment{
+				"a": {
+					id:               "a_id",
+					status:           runningStatus,
+					forcedVariations: map[string]Variation{},
+					trafficAllocation: []trafficAllocation{{
+						endOfRange: maxTrafficValue,
+						Variation:  Variation{id: "abc", Key: "abc"},
+					}},
+					cachedVariations: map[string]Variation{},
+					mutex:            &sync.RWMutex{},
+					group: &group{
+						id:                "group",
+						trafficAllocation: []groupAllocation{{endOfRange: maxTrafficValue, experimentID: "a_id"}},
+					},
+				},
+			}},
+			"a",
+			"user",
+			&Impression{Variation: Variation{id: "abc", Key: "abc"}, UserID: "user"},
+			true,
 		}, {
 			"user is bucketed into experiment",
 			Project{experiments: map[string]Experiment{
@@ -188,13 +434,203 @@ func TestProject_GetVariation(t *testing.T) {
 				test.expectedImpression.Timestamp = result.Timestamp
 			}
 			assert.Equal(t, test.expectedImpression, result)
+			cachedVariations := test.project.experiments[test.experimentName].cachedVariations
 			if test.shouldCache {
-				assert.Contains(t, test.project.experiments[test.experimentName].cachedVariations, test.userID)
+				assert.Contains(t, cachedVariations, test.userID)
+			} else {
+				assert.NotContains(t, cachedVariations, test.userID)
+			}
+		})
+	}
+}
+
+func TestProject_SetMaxTrafficValue(t *testing.T) {
+	newProject := func() Project {
+		return Project{experiments: map[string]Experiment{
+			"a": {
+				id:               "1886780721",
+				status:           runningStatus,
+				forcedVariations: map[string]Variation{},
+				trafficAllocation: []trafficAllocation{
+					{endOfRange: 525000, Variation: Variation{id: "a", Key: "a"}},
+					{endOfRange: 1000000, Variation: Variation{id: "b", Key: "b"}},
+				},
+				cachedVariations: map[string]Variation{},
+				mutex:            &sync.RWMutex{},
+			},
+		}}
+	}
+	// ppid1 is in bucket 5254 of 10000 and bucket 525464 of 1000000
+	p := newProject()
+	assert.Equal(t, "a", p.GetVariation("a", "ppid1").Key)
+	p = newProject()
+	p.SetMaxTrafficValue(1000000)
+	assert.Equal(t, "b", p.GetVariation("a", "ppid1").Key)
+}
+
+func TestProject_SetBucketingKey(t *testing.T) {
+	tests := []struct {
+		name              string
+		bucketingKey      func(bucketingID, entityID string) string
+		expectedBucket    int
+		expectedVariation string
+	}{
+		{"default matches Optimizely", nil, 5254, "a"},
+		{"entity ID first", func(bucketingID, entityID string) string { return entityID + bucketingID }, 8391, "b"},
+		{
+			"delimited",
+			func(bucketingID, entityID string) string { return fmt.Sprintf("%v:%v", bucketingID, entityID) },
+			9786,
+			"b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Project{experiments: map[string]Experiment{
+				"a": {
+					id:               "1886780721",
+					status:           runningStatus,
+					forcedVariations: map[string]Variation{},
+					trafficAllocation: []trafficAllocation{
+						{endOfRange: 5300, Variation: Variation{id: "a", Key: "a"}},
+						{endOfRange: 10000, Variation: Variation{id: "b", Key: "b"}},
+					},
+					cachedVariations: map[string]Variation{},
+					mutex:            &sync.RWMutex{},
+				},
+			}}
+			if test.bucketingKey != nil {
+				p.SetBucketingKey(test.bucketingKey)
+			}
+			assert.Equal(t, test.expectedBucket, p.getBucketValue("ppid1", "1886780721"))
+			assert.Equal(t, test.expectedVariation, p.GetVariation("a", "ppid1").Key)
+		})
+	}
+}
+
+func TestProject_SetExperimentNamespace(t *testing.T) {
+	tests := []struct {
+		name              string
+		namespaces        map[string]string
+		expectedBucket    int
+		expectedVariation string
+	}{
+		{"no namespace buckets by experiment ID", nil, 5254, "a"},
+		{"namespace re-randomizes the experiment", map[string]string{"exp": "rerun"}, 5689, "b"},
+		{"namespace of another experiment has no effect", map[string]string{"other": "rerun"}, 5254, "a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			experiment := Experiment{
+				Key:              "exp",
+				id:               "1886780721",
+				status:           runningStatus,
+				forcedVariations: map[string]Variation{},
+				trafficAllocation: []trafficAllocation{
+					{endOfRange: 5500, Variation: Variation{id: "a", Key: "a"}},
+					{endOfRange: 10000, Variation: Variation{id: "b", Key: "b"}},
+				},
+				cachedVariations: map[string]Variation{},
+				mutex:            &sync.RWMutex{},
 			}
+			p := Project{experiments: map[string]Experiment{"exp": experiment}}
+			for key, namespace := range test.namespaces {
+				p.SetExperimentNamespace(key, namespace)
+			}
+			assert.Equal(t, test.expectedBucket, p.getBucketValue("ppid1", p.bucketingEntityID(experiment)))
+			assert.Equal(t, test.expectedVariation, p.GetVariation("exp", "ppid1").Key)
 		})
 	}
 }
 
+func TestProject_GetVariationAt(t *testing.T) {
+	p := Project{experiments: map[string]Experiment{
+		"a": {
+			id:     "1",
+			status: runningStatus,
+			forcedVariations: map[string]Variation{
+				"forced": {id: "forced", Key: "forced"},
+			},
+			trafficAllocation: []trafficAllocation{{endOfRange: 10000, Variation: Variation{id: "b", Key: "b"}}},
+			cachedVariations:  map[string]Variation{},
+			mutex:             &sync.RWMutex{},
+		},
+	}}
+	ts := time.Date(2019, time.March, 4, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		userID string
+	}{
+		{"forced variation", "forced"},
+		{"bucketed variation", "user"},
+		// the second lookup of the same user is served from the cache
+		{"cached variation", "user"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			impression := p.GetVariationAt("a", test.userID, ts)
+			require.NotNil(t, impression)
+			assert.Equal(t, ts, impression.Timestamp)
+		})
+	}
+}
+
+func TestProject_OnUnknownStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        string
+		expectUnknown bool
+	}{
+		{"paused", "Paused", false},
+		{"not started", "Not started", false},
+		{"archived", "Archived", false},
+		{"launched", "Launched", false},
+		{"novel status", "Scheduled", true},
+		{"misspelled status", "running", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Project{experiments: map[string]Experiment{"a": {Key: "a", status: test.status}}}
+			unknown := make(map[string]string)
+			p.OnUnknownStatus(func(experimentKey, status string) { unknown[experimentKey] = status })
+			assert.Nil(t, p.GetVariation("a", "user"))
+			if test.expectUnknown {
+				assert.Equal(t, map[string]string{"a": test.status}, unknown)
+			} else {
+				assert.Empty(t, unknown)
+			}
+		})
+	}
+}
+
+func TestProject_GetVariation_strictExperimentKeys(t *testing.T) {
+	p := Project{experiments: map[string]Experiment{
+		"a": {
+			status: runningStatus,
+			forcedVariations: map[string]Variation{
+				"user": {id: "abc", Key: "abc"},
+			},
+		},
+		"d": {
+			status: runningStatus,
+			forcedVariations: map[string]Variation{
+				"user": {id: "abc", Key: "abc"},
+			},
+		},
+	}}
+	p.RegisterKnownExperiments("a", "b")
+	unknown := make([]string, 0)
+	p.StrictExperimentKeys(func(experimentKey string) { unknown = append(unknown, experimentKey) })
+
+	assert.NotNil(t, p.GetVariation("a", "user"))
+	// registered experiments missing from the datafile are not reported as unknown
+	assert.Nil(t, p.GetVariation("b", "user"))
+	assert.Nil(t, p.GetVariation("c", "user"))
+	// unregistered experiments are rejected even if they are in the datafile
+	assert.Nil(t, p.GetVariation("d", "user"))
+	assert.Equal(t, []string{"c", "d"}, unknown)
+}
+
 func TestGetVariation(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -239,3 +675,228 @@ func TestGetVariation(t *testing.T) {
 		})
 	}
 }
+
+func TestGetVariation_concurrent(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "status": "Running",
+      "id": "5678",
+      "key": "a",
+      "variations": [{"id": "abc123", "key": "variation_1"}],
+      "trafficAllocation": [{"entityId": "abc123", "endOfRange": 5000}]
+    },
+    {
+      "status": "Running",
+      "id": "9012",
+      "key": "b",
+      "variations": [{"id": "def456", "key": "variation_1"}],
+      "trafficAllocation": [{"entityId": "def456", "endOfRange": 10000}]
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	ctx := project.ToContext(context.Background(), "user")
+	const goroutines, calls = 20, 50
+	var bucketed int64
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				experiment := "a"
+				if (g+i)%2 == 0 {
+					experiment = "b"
+				}
+				if GetVariation(ctx, experiment).Key != "" {
+					atomic.AddInt64(&bucketed, 1)
+				}
+				// reading impressions concurrently with recording them must be safe too
+				ImpressionsFromContext(ctx)
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.NotZero(t, bucketed)
+	assert.Len(t, ImpressionsFromContext(ctx), int(bucketed))
+}
+
+func TestForcedVariationsFromContext(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "id": "1",
+      "key": "an_experiment",
+      "status": "Running",
+      "variations": [{"id": "abc", "key": "variation_1"}, {"id": "def", "key": "variation_2"}],
+      "trafficAllocation": [{"entityId": "abc", "endOfRange": 10000}],
+      "forcedVariations": {"qa_user": "variation_1", "user": "variation_1"}
+    },
+    {
+      "id": "2",
+      "key": "paused_experiment",
+      "status": "Paused",
+      "variations": [{"id": "ghi", "key": "variation_1"}],
+      "forcedVariations": {"qa_user": "variation_1"}
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	tests := []struct {
+		name                     string
+		experimentKey            string
+		overrides                map[string]string
+		expectedForcedVariations map[string]string
+	}{
+		{
+			"datafile forced variations",
+			"an_experiment",
+			nil,
+			map[string]string{"qa_user": "variation_1", "user": "variation_1"},
+		}, {
+			"runtime override takes precedence for the user of the context",
+			"an_experiment",
+			map[string]string{"an_experiment": "variation_2"},
+			map[string]string{"qa_user": "variation_1", "user": "variation_2"},
+		}, {
+			"override for unknown variation is ignored",
+			"an_experiment",
+			map[string]string{"an_experiment": "unknown"},
+			map[string]string{"qa_user": "variation_1", "user": "variation_1"},
+		}, {
+			"override for experiment that is not running is ignored",
+			"paused_experiment",
+			map[string]string{"paused_experiment": "variation_1"},
+			map[string]string{"qa_user": "variation_1"},
+		}, {
+			"unknown experiment",
+			"unknown",
+			map[string]string{"unknown": "variation_1"},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := project.ToContext(context.Background(), "user")
+			if test.overrides != nil {
+				ctx = WithForcedVariations(ctx, test.overrides)
+			}
+			assert.Equal(t, test.expectedForcedVariations, ForcedVariationsFromContext(ctx, test.experimentKey))
+		})
+	}
+	assert.Nil(t, ForcedVariationsFromContext(context.Background(), "an_experiment"))
+}
+
+func TestGetVariation_withForcedVariations(t *testing.T) {
+	experiment := Experiment{
+		status:           runningStatus,
+		forcedVariations: map[string]Variation{},
+		trafficAllocation: []trafficAllocation{{
+			endOfRange: maxTrafficValue,
+			Variation:  Variation{id: "abc", Key: "abc"},
+		}},
+		variations: map[string]Variation{
+			"abc": {id: "abc", Key: "abc"},
+			"def": {id: "def", Key: "def"},
+		},
+		cachedVariations: map[string]Variation{},
+		mutex:            &sync.RWMutex{},
+	}
+	tests := []struct {
+		name              string
+		overrides         map[string]string
+		expectedVariation Variation
+	}{
+		{
+			"override in context wins over traffic allocation",
+			map[string]string{"a": "def"},
+			Variation{id: "def", Key: "def"},
+		}, {
+			"override for unknown variation is ignored",
+			map[string]string{"a": "ghi"},
+			Variation{id: "abc", Key: "abc"},
+		}, {
+			"override for another experiment is ignored",
+			map[string]string{"b": "def"},
+			Variation{id: "abc", Key: "abc"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project := Project{experiments: map[string]Experiment{"a": experiment}}
+			ctx := WithForcedVariations(project.ToContext(context.Background(), "user"), test.overrides)
+			assert.Equal(t, test.expectedVariation, GetVariation(ctx, "a"))
+			impressions := ctx.Value(projCtxKey).(*projectContext).impressions
+			require.Len(t, impressions, 1)
+			assert.Equal(t, test.expectedVariation, impressions[0].Variation)
+		})
+	}
+	// overrides must not leak into contexts without them
+	project := Project{experiments: map[string]Experiment{"a": experiment}}
+	assert.Equal(t, Variation{id: "abc", Key: "abc"}, GetVariation(project.ToContext(context.Background(), "user"), "a"))
+}
+
+func TestIsForced(t *testing.T) {
+	newProject := func() Project {
+		return Project{experiments: map[string]Experiment{
+			"a": {
+				status:           runningStatus,
+				forcedVariations: map[string]Variation{"pinned": {id: "def", Key: "def"}},
+				variations: map[string]Variation{
+					"abc": {id: "abc", Key: "abc"},
+					"def": {id: "def", Key: "def"},
+				},
+				cachedVariations: map[string]Variation{},
+				mutex:            &sync.RWMutex{},
+			},
+			"paused": {
+				status:           "Paused",
+				forcedVariations: map[string]Variation{"pinned": {id: "def", Key: "def"}},
+			},
+		}}
+	}
+	tests := []struct {
+		name             string
+		experimentKey    string
+		userID           string
+		overrides        map[string]string
+		expectedKey      string
+		expectedForced   bool
+		expectedInCtxKey string
+		expectedInCtx    bool
+	}{
+		{"forced by the datafile", "a", "pinned", nil, "def", true, "def", true},
+		{"not forced", "a", "user", nil, "", false, "", false},
+		{"forced by a runtime override", "a", "user", map[string]string{"a": "abc"}, "", false, "abc", true},
+		{"runtime override wins over the datafile", "a", "pinned", map[string]string{"a": "abc"}, "def", true, "abc", true},
+		{"runtime override for an unknown variation", "a", "user", map[string]string{"a": "ghi"}, "", false, "", false},
+		{"experiment not running", "paused", "pinned", map[string]string{"paused": "def"}, "", false, "", false},
+		{"unknown experiment", "b", "pinned", nil, "", false, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newProject()
+			key, forced := p.IsForced(test.experimentKey, test.userID)
+			assert.Equal(t, test.expectedKey, key)
+			assert.Equal(t, test.expectedForced, forced)
+
+			ctx := WithForcedVariations(p.ToContext(context.Background(), test.userID), test.overrides)
+			key, forced = IsForced(ctx, test.experimentKey)
+			assert.Equal(t, test.expectedInCtxKey, key)
+			assert.Equal(t, test.expectedInCtx, forced)
+			// introspection neither records impressions nor caches variations
+			assert.Len(t, ImpressionsFromContext(ctx), 0)
+			assert.Len(t, p.experiments["a"].cachedVariations, 0)
+		})
+	}
+	key, forced := IsForced(context.Background(), "a")
+	assert.Equal(t, "", key)
+	assert.False(t, forced)
+}
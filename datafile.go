@@ -0,0 +1,338 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Datafiles produced by tools other than Optimizely sometimes encode numbers as strings or IDs as
+// numbers. The unmarshalers in this file accept both encodings of the affected fields so that
+// such datafiles can be loaded.
+
+// datafileString is a string field of the datafile, such as an ID, that may be encoded as a number.
+type datafileString string
+
+// UnmarshalJSON decodes a JSON string or number.
+func (s *datafileString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		*s = datafileString(str)
+		return nil
+	}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("expected string or number but found %s", data)
+	}
+	*s = datafileString(number)
+	return nil
+}
+
+// datafileInt is an integer field of the datafile that may be encoded as a string.
+type datafileInt int
+
+// UnmarshalJSON decodes a JSON number or a string containing an integer.
+func (i *datafileInt) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		value, err := strconv.Atoi(str)
+		if err != nil {
+			return fmt.Errorf("expected integer but found %q", str)
+		}
+		*i = datafileInt(value)
+		return nil
+	}
+	var value int
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*i = datafileInt(value)
+	return nil
+}
+
+// UnmarshalJSON decodes the datafile, accepting numeric IDs.
+func (d *Datafile) UnmarshalJSON(data []byte) error {
+	// the alias has the fields but not the methods of Datafile, which avoids infinite recursion
+	type alias Datafile
+	aux := struct {
+		*alias
+		Version   datafileString `json:"version"`
+		Revision  datafileString `json:"revision"`
+		ProjectID datafileString `json:"projectId"`
+		AccountID datafileString `json:"accountId"`
+	}{alias: (*alias)(d)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	d.Version = string(aux.Version)
+	d.Revision = string(aux.Revision)
+	d.ProjectID = string(aux.ProjectID)
+	d.AccountID = string(aux.AccountID)
+	return nil
+}
+
+// UnmarshalJSON decodes the experiment, accepting numeric IDs.
+func (e *DatafileExperiment) UnmarshalJSON(data []byte) error {
+	type alias DatafileExperiment
+	aux := struct {
+		*alias
+		ID      datafileString `json:"id"`
+		LayerID datafileString `json:"layerId"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	e.ID = string(aux.ID)
+	e.LayerID = string(aux.LayerID)
+	return nil
+}
+
+// UnmarshalJSON decodes the variation, accepting a numeric ID.
+func (v *DatafileVariation) UnmarshalJSON(data []byte) error {
+	type alias DatafileVariation
+	aux := struct {
+		*alias
+		ID datafileString `json:"id"`
+	}{alias: (*alias)(v)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	v.ID = string(aux.ID)
+	return nil
+}
+
+// UnmarshalJSON decodes the traffic allocation, accepting a numeric entity ID and a stringified
+// end of range.
+func (a *DatafileTrafficAllocation) UnmarshalJSON(data []byte) error {
+	type alias DatafileTrafficAllocation
+	aux := struct {
+		*alias
+		EntityID   datafileString `json:"entityId"`
+		EndOfRange datafileInt    `json:"endOfRange"`
+	}{alias: (*alias)(a)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	a.EntityID = string(aux.EntityID)
+	a.EndOfRange = int(aux.EndOfRange)
+	return nil
+}
+
+// UnmarshalJSON decodes the group, accepting a numeric ID.
+func (g *DatafileGroup) UnmarshalJSON(data []byte) error {
+	type alias DatafileGroup
+	aux := struct {
+		*alias
+		ID datafileString `json:"id"`
+	}{alias: (*alias)(g)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	g.ID = string(aux.ID)
+	return nil
+}
+
+// UnmarshalJSON decodes the event, accepting a numeric ID.
+func (e *DatafileEvent) UnmarshalJSON(data []byte) error {
+	type alias DatafileEvent
+	aux := struct {
+		*alias
+		ID datafileString `json:"id"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	e.ID = string(aux.ID)
+	return nil
+}
+
+// UnmarshalJSON decodes the feature flag, accepting numeric IDs.
+func (f *DatafileFeatureFlag) UnmarshalJSON(data []byte) error {
+	type alias DatafileFeatureFlag
+	aux := struct {
+		*alias
+		ID        datafileString `json:"id"`
+		RolloutID datafileString `json:"rolloutId"`
+	}{alias: (*alias)(f)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	f.ID = string(aux.ID)
+	f.RolloutID = string(aux.RolloutID)
+	return nil
+}
+
+// streamedDatafile is the result of decoding a datafile with decodeDatafile.
+type streamedDatafile struct {
+	version, revision, projectID, accountID, region, sdkKey string
+	// experiments listed at the top level and within groups, by key
+	experiments, groupExperiments map[string]Experiment
+	// conversion events, by key
+	events map[string]conversionEvent
+	// feature flags, by key
+	features map[string]Feature
+	// the first error creating an experiment at the top level and within groups, respectively
+	experimentsErr, groupsErr error
+}
+
+// decodeDatafile unmarshals a datafile like a Datafile, except that the experiments listed at the top
+// level, which make up most of a datafile, are created as they are decoded with streamedExperiments
+// rather than held in memory as DatafileExperiments. Errors unmarshaling the JSON are returned, while
+// errors creating experiments are recorded in the result so that they can be reported after the
+// version of the datafile has been checked, like when the datafile is unmarshaled.
+func decodeDatafile(datafileJSON []byte, project *Project) (streamedDatafile, error) {
+	// the alias has the fields but not the methods of Datafile, like in Datafile.UnmarshalJSON
+	type alias Datafile
+	aux := struct {
+		*alias
+		Version     datafileString      `json:"version"`
+		Revision    datafileString      `json:"revision"`
+		ProjectID   datafileString      `json:"projectId"`
+		AccountID   datafileString      `json:"accountId"`
+		Experiments streamedExperiments `json:"experiments"`
+	}{alias: &alias{}, Experiments: streamedExperiments{project: project}}
+	if err := json.Unmarshal(datafileJSON, &aux); err != nil {
+		return streamedDatafile{}, err
+	}
+	df := streamedDatafile{
+		version:        string(aux.Version),
+		revision:       string(aux.Revision),
+		projectID:      string(aux.ProjectID),
+		accountID:      string(aux.AccountID),
+		region:         aux.Region,
+		sdkKey:         aux.SDKKey,
+		experiments:    aux.Experiments.experiments,
+		experimentsErr: aux.Experiments.err,
+	}
+	for _, g := range aux.Groups {
+		if df.groupExperiments == nil {
+			df.groupExperiments = make(map[string]Experiment)
+		}
+		grp := newGroup(g)
+		for _, exp := range g.Experiments {
+			experiment, err := newExperiment(exp, grp, project)
+			if err != nil {
+				if df.groupsErr == nil {
+					df.groupsErr = err
+				}
+				break
+			}
+			df.groupExperiments[experiment.Key] = experiment
+		}
+	}
+	for _, ev := range aux.Events {
+		if df.events == nil {
+			df.events = make(map[string]conversionEvent)
+		}
+		df.events[ev.Key] = newConversionEvent(ev, project)
+	}
+	for _, f := range aux.FeatureFlags {
+		if df.features == nil {
+			df.features = make(map[string]Feature)
+		}
+		df.features[f.Key] = newFeature(f, project)
+	}
+	return df, nil
+}
+
+// streamedExperiments is the list of experiments of a datafile, which is unmarshaled by creating each
+// experiment as soon as it is decoded. Unlike unmarshaling a []DatafileExperiment, this never holds
+// every DatafileExperiment in memory at once, which reduces the memory needed to load datafiles with
+// many experiments.
+type streamedExperiments struct {
+	// project that the experiments are created for
+	project *Project
+	// the created experiments, by key; nil if there were none
+	experiments map[string]Experiment
+	// the first error creating an experiment
+	err error
+}
+
+// UnmarshalJSON creates the experiments of a JSON array one at a time. Null is treated as an empty
+// array.
+func (s *streamedExperiments) UnmarshalJSON(data []byte) error {
+	// a repeated key replaces the previous value
+	s.experiments, s.err = nil, nil
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if data[0] != '[' {
+		// unmarshaling reports values that are not arrays like any other slice of experiments
+		return json.Unmarshal(data, &[]DatafileExperiment{})
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// consume the opening bracket; the array was already validated by json.Unmarshal
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	// reused to decode each experiment; nothing decoded is retained by the created experiments
+	var exp DatafileExperiment
+	for dec.More() {
+		// the slices are cleared rather than replaced to reuse their capacity, while other fields,
+		// including the forced variations map, must not carry over between experiments
+		exp = DatafileExperiment{
+			Variations:        clearVariations(exp.Variations),
+			TrafficAllocation: clearTrafficAllocation(exp.TrafficAllocation),
+		}
+		if err := dec.Decode(&exp); err != nil {
+			return err
+		}
+		if s.experiments == nil {
+			s.experiments = make(map[string]Experiment)
+		}
+		experiment, err := newExperiment(exp, nil, s.project)
+		if err != nil {
+			if s.err == nil {
+				s.err = err
+			}
+			continue
+		}
+		s.experiments[experiment.Key] = experiment
+	}
+	return nil
+}
+
+// Decoding a JSON array into a slice reuses the elements within its capacity, and decoding an element
+// leaves the fields that are missing from its JSON unchanged. The following functions zero the
+// elements of a slice that is reused for decoding, so that no field carries over from a previously
+// decoded element, and return the slice truncated to length zero.
+
+func clearVariations(variations []DatafileVariation) []DatafileVariation {
+	variations = variations[:cap(variations)]
+	for i := range variations {
+		variations[i] = DatafileVariation{}
+	}
+	return variations[:0]
+}
+
+func clearTrafficAllocation(allocations []DatafileTrafficAllocation) []DatafileTrafficAllocation {
+	allocations = allocations[:cap(allocations)]
+	for i := range allocations {
+		allocations[i] = DatafileTrafficAllocation{}
+	}
+	return allocations[:0]
+}
@@ -0,0 +1,318 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProjectFromDataFile_stringifiedNumbers(t *testing.T) {
+	numeric := []byte(`
+{
+  "version": "4",
+  "projectId": "1234",
+  "accountId": "00001",
+  "revision": "666",
+  "experiments": [
+    {
+      "status": "Running",
+      "variations": [{"id": "123", "key": "variation_1"}, {"id": "456", "key": "variation_2"}],
+      "id": "5678",
+      "key": "an_experiment",
+      "layerId": "910",
+      "trafficAllocation": [{"entityId": "123", "endOfRange": 3000}, {"entityId": "456", "endOfRange": 10000}],
+      "forcedVariations": {"xyz": "variation_1"}
+    }
+  ],
+  "groups": [
+    {
+      "id": "111",
+      "policy": "random",
+      "trafficAllocation": [{"entityId": "9012", "endOfRange": 10000}],
+      "experiments": [
+        {
+          "status": "Running",
+          "variations": [{"id": "789", "key": "variation_1"}],
+          "id": "9012",
+          "key": "grouped_experiment",
+          "layerId": "1314",
+          "trafficAllocation": [{"entityId": "789", "endOfRange": 10000}]
+        }
+      ]
+    }
+  ]
+}
+`)
+	stringified := []byte(`
+{
+  "version": 4,
+  "projectId": 1234,
+  "accountId": "00001",
+  "revision": 666,
+  "experiments": [
+    {
+      "status": "Running",
+      "variations": [{"id": 123, "key": "variation_1"}, {"id": 456, "key": "variation_2"}],
+      "id": 5678,
+      "key": "an_experiment",
+      "layerId": 910,
+      "trafficAllocation": [{"entityId": 123, "endOfRange": "3000"}, {"entityId": 456, "endOfRange": "10000"}],
+      "forcedVariations": {"xyz": "variation_1"}
+    }
+  ],
+  "groups": [
+    {
+      "id": 111,
+      "policy": "random",
+      "trafficAllocation": [{"entityId": 9012, "endOfRange": "10000"}],
+      "experiments": [
+        {
+          "status": "Running",
+          "variations": [{"id": 789, "key": "variation_1"}],
+          "id": 9012,
+          "key": "grouped_experiment",
+          "layerId": 1314,
+          "trafficAllocation": [{"entityId": 789, "endOfRange": "10000"}]
+        }
+      ]
+    }
+  ]
+}
+`)
+	expected, err := NewProjectFromDataFile(numeric)
+	require.NoError(t, err)
+	project, err := NewProjectFromDataFile(stringified)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Version, project.Version)
+	assert.Equal(t, expected.Revision, project.Revision)
+	assert.Equal(t, expected.ProjectID, project.ProjectID)
+	assert.Equal(t, expected.AccountID, project.AccountID)
+	require.Equal(t, expected.ExperimentCount(), project.ExperimentCount())
+	for key, experiment := range expected.experiments {
+		assert.True(t, experiment.SameConfig(project.experiments[key]), key)
+	}
+}
+
+func TestNewProjectFromDataFile_invalidNumbers(t *testing.T) {
+	tests := []struct {
+		name     string
+		datafile string
+	}{
+		{
+			"non-numeric end of range",
+			`{"version": "4", "experiments": [{"key": "a", "variations": [{"id": "1"}],
+			  "trafficAllocation": [{"entityId": "1", "endOfRange": "all"}]}]}`,
+		}, {
+			"fractional end of range",
+			`{"version": "4", "experiments": [{"key": "a", "variations": [{"id": "1"}],
+			  "trafficAllocation": [{"entityId": "1", "endOfRange": "50.5"}]}]}`,
+		}, {
+			"boolean ID",
+			`{"version": "4", "experiments": [{"key": "a", "id": true}]}`,
+		}, {
+			"object ID",
+			`{"version": "4", "groups": [{"id": {}}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewProjectFromDataFile([]byte(test.datafile))
+			assert.Error(t, err)
+		})
+	}
+}
+
+// newProjectFromDataFileUnmarshal creates a project by unmarshaling the whole datafile before creating
+// its experiments, which is how NewProjectFromDataFile worked before datafiles were decoded one
+// experiment at a time. It is the reference that decoded projects are compared against.
+func newProjectFromDataFileUnmarshal(datafileJSON []byte) (Project, error) {
+	df := Datafile{}
+	if err := json.Unmarshal(datafileJSON, &df); err != nil {
+		return Project{}, err
+	}
+	if df.Version != supportedDatafileVersion {
+		return Project{}, fmt.Errorf("could not create project from unsupported datafile version %v", df.Version)
+	}
+	project := Project{
+		Version:     df.Version,
+		Revision:    df.Revision,
+		ProjectID:   df.ProjectID,
+		AccountID:   df.AccountID,
+		Region:      df.Region,
+		SDKKey:      df.SDKKey,
+		RawDataFile: datafileJSON,
+	}
+	experiments := make(map[string]Experiment, len(df.Experiments))
+	for _, exp := range df.Experiments {
+		experiment, err := newExperiment(exp, nil, &project)
+		if err != nil {
+			return Project{}, err
+		}
+		experiments[experiment.Key] = experiment
+	}
+	for _, g := range df.Groups {
+		grp := newGroup(g)
+		for _, exp := range g.Experiments {
+			experiment, err := newExperiment(exp, grp, &project)
+			if err != nil {
+				return Project{}, err
+			}
+			experiments[experiment.Key] = experiment
+		}
+	}
+	project.experiments = experiments
+	for _, ev := range df.Events {
+		if project.events == nil {
+			project.events = make(map[string]conversionEvent)
+		}
+		project.events[ev.Key] = newConversionEvent(ev, &project)
+	}
+	project.features = make(map[string]Feature, len(df.FeatureFlags))
+	for _, f := range df.FeatureFlags {
+		project.features[f.Key] = newFeature(f, &project)
+	}
+	resolveFeatureExperiments(project.features, project.experiments)
+	return project, nil
+}
+
+// assertDecodedProjectMatchesUnmarshal checks that NewProjectFromDataFile creates the same project, or
+// fails in the same case, as unmarshaling the whole datafile.
+func assertDecodedProjectMatchesUnmarshal(t *testing.T, datafile []byte) {
+	expected, expectedErr := newProjectFromDataFileUnmarshal(datafile)
+	actual, actualErr := NewProjectFromDataFile(datafile)
+	if expectedErr != nil {
+		assert.Error(t, actualErr)
+		return
+	}
+	require.NoError(t, actualErr)
+	assert.Equal(t, expected, actual)
+}
+
+func TestNewProjectFromDataFile_matchesUnmarshal(t *testing.T) {
+	experiment := func(id, key string) string {
+		return fmt.Sprintf(`{
+			"id": %q, "key": %q, "layerId": "layer", "status": "Running",
+			"variations": [{"id": "v1", "key": "a"}, {"id": "v2", "key": "b"}],
+			"trafficAllocation": [{"entityId": "v1", "endOfRange": 5000}, {"entityId": "v2", "endOfRange": 10000}],
+			"forcedVariations": {"user": "b"}
+		}`, id, key)
+	}
+	tests := []struct {
+		name     string
+		datafile string
+	}{
+		{"experiments", `{"version": "4", "revision": "1", "experiments": [` + experiment("1", "a") + `, ` + experiment("2", "b") + `]}`},
+		{"duplicate experiment keys", `{"version": "4", "experiments": [` + experiment("1", "a") + `, ` + experiment("2", "a") + `]}`},
+		{
+			"groups before experiments take precedence",
+			`{"version": "4", "groups": [{"id": "g", "policy": "random", "trafficAllocation": [{"entityId": "1", "endOfRange": 10000}],
+			"experiments": [` + experiment("1", "a") + `]}], "experiments": [` + experiment("2", "a") + `]}`,
+		},
+		{"overlapping group", `{"version": "4", "groups": [{"id": "g", "policy": "overlapping", "experiments": [` + experiment("1", "a") + `]}]}`},
+		{"repeated key replaces the previous value", `{"version": "4", "experiments": [{}], "experiments": [` + experiment("1", "a") + `]}`},
+		{"keys are case-insensitive", `{"Version": 4, "REVISION": 5, "ProjectID": "6", "Experiments": [` + experiment("1", "a") + `]}`},
+		{"unknown keys are skipped", `{"version": "4", "attributes": [{"id": "a", "key": "country"}], "region": "EU"}`},
+		{
+			"feature flags",
+			`{"version": "4", "experiments": [` + experiment("1", "a") + `], "featureFlags": [
+			{"id": 3, "key": "checkout", "experimentIds": ["1"], "rolloutId": 4, "variables": [{"id": "5", "key": "color", "type": "string", "defaultValue": "red"}]},
+			{"id": "6", "key": "search", "experimentIds": ["7"]}]}`,
+		},
+		{
+			"fields of variations are not reused between experiments",
+			`{"version": "4", "experiments": [
+			{"id": "1", "key": "a", "variations": [{"id": "v1", "key": "a", "featureEnabled": true}]},
+			{"id": "2", "key": "b", "variations": [{"id": "v1", "key": "a"}]}]}`,
+		},
+		{
+			"fields of traffic allocations are not reused between experiments",
+			`{"version": "4", "experiments": [
+			{"id": "1", "key": "a", "variations": [{"id": "v1", "key": "a"}], "trafficAllocation": [{"entityId": "v1", "endOfRange": 10000}]},
+			{"id": "2", "key": "b", "variations": [{"id": "v1", "key": "a"}], "trafficAllocation": [{"endOfRange": 5000}]}]}`,
+		},
+		{"feature flags is not an array", `{"version": "4", "featureFlags": "checkout"}`},
+		{"events", `{"version": "4", "events": [{"id": 1, "key": "purchase", "experimentIds": ["1"]}, {"id": "2", "key": "signup"}]}`},
+		{"duplicate event keys", `{"version": "4", "events": [{"id": "1", "key": "purchase", "experimentIds": ["1", "2"]}, {"id": "2", "key": "purchase"}]}`},
+		{"events is not an array", `{"version": "4", "events": {}}`},
+		{"null values", `{"version": "4", "revision": null, "experiments": null, "groups": null, "events": null, "featureFlags": null}`},
+		{"null datafile", `null`},
+		{"unsupported version after invalid experiment", `{"experiments": [{}], "version": "3"}`},
+		{"invalid experiment after version", `{"version": "4", "experiments": [{}]}`},
+		{"invalid grouped experiment", `{"version": "4", "groups": [{"id": "g", "experiments": [{"id": "1"}]}]}`},
+		{"experiments is not an array", `{"version": "4", "experiments": {}}`},
+		{"datafile is not an object", `[]`},
+		{"invalid region", `{"version": "4", "region": 5}`},
+		{"sdk key", `{"version": "4", "sdkKey": "AbC123", "SDKKEY": "DeF456"}`},
+		{"invalid sdk key", `{"version": "4", "sdkKey": 5}`},
+		{"invalid JSON", `{"version": "4",}`},
+		{"trailing data", `{"version": "4"} {}`},
+		{"empty", ``},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertDecodedProjectMatchesUnmarshal(t, []byte(test.datafile))
+		})
+	}
+}
+
+// largeDatafile builds a datafile with the given number of experiments, each with two variations.
+func largeDatafile(experiments int) []byte {
+	df := Datafile{Version: "4", Revision: "1", ProjectID: "1234", AccountID: "5678"}
+	for i := 0; i < experiments; i++ {
+		id := fmt.Sprintf("%d", 100000+i)
+		df.Experiments = append(df.Experiments, DatafileExperiment{
+			ID:         id,
+			Key:        "experiment_" + id,
+			LayerID:    "layer_" + id,
+			Status:     "Running",
+			Variations: []DatafileVariation{{ID: id + "1", Key: "control"}, {ID: id + "2", Key: "treatment"}},
+			TrafficAllocation: []DatafileTrafficAllocation{
+				{EntityID: id + "1", EndOfRange: 5000},
+				{EntityID: id + "2", EndOfRange: 10000},
+			},
+			ForcedVariations: map[string]string{"qa_user": "treatment"},
+		})
+	}
+	datafile, err := json.Marshal(df)
+	if err != nil {
+		panic(err)
+	}
+	return datafile
+}
+
+func BenchmarkNewProjectFromDataFile(b *testing.B) {
+	datafile := largeDatafile(5000)
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := newProjectFromDataFileUnmarshal(datafile); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := NewProjectFromDataFile(datafile); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
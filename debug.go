@@ -0,0 +1,98 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// debugProject is the JSON representation of a project served by DebugHandler.
+type debugProject struct {
+	Version     string            `json:"version"`
+	Revision    string            `json:"revision"`
+	ProjectID   string            `json:"projectId"`
+	AccountID   string            `json:"accountId"`
+	Experiments []debugExperiment `json:"experiments"`
+}
+
+// debugExperiment is the JSON representation of an experiment served by DebugHandler.
+type debugExperiment struct {
+	ID                string                   `json:"id"`
+	Key               string                   `json:"key"`
+	Status            string                   `json:"status"`
+	GroupID           string                   `json:"groupId,omitempty"`
+	Variations        []string                 `json:"variations"`
+	TrafficAllocation []debugTrafficAllocation `json:"trafficAllocation"`
+}
+
+// debugTrafficAllocation is the JSON representation of a traffic allocation served by DebugHandler.
+type debugTrafficAllocation struct {
+	Variation  string `json:"variation"`
+	EndOfRange int    `json:"endOfRange"`
+}
+
+// DebugHandler returns a read-only http.Handler that serves the experiments of the current project,
+// their statuses and traffic allocations, and the datafile revision as JSON. The current project is
+// read once per request from the given function, so the handler reflects projects that are swapped
+// after it is created, e.g. when the datafile is reloaded, and each response is built from a single
+// project. The function must be safe to call concurrently with swaps, e.g. by loading the project
+// from an atomic.Value.
+func DebugHandler(current func() Project) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		project := current()
+		dp := debugProject{
+			Version:     project.Version,
+			Revision:    project.Revision,
+			ProjectID:   project.ProjectID,
+			AccountID:   project.AccountID,
+			Experiments: make([]debugExperiment, 0, len(project.experiments)),
+		}
+		for _, experiment := range project.experiments {
+			de := debugExperiment{
+				ID:                experiment.id,
+				Key:               experiment.Key,
+				Status:            experiment.status,
+				Variations:        make([]string, 0, len(experiment.variations)),
+				TrafficAllocation: make([]debugTrafficAllocation, 0, len(experiment.trafficAllocation)),
+			}
+			if experiment.group != nil {
+				de.GroupID = experiment.group.id
+			}
+			for key := range experiment.variations {
+				de.Variations = append(de.Variations, key)
+			}
+			sort.Strings(de.Variations)
+			for _, allocation := range experiment.trafficAllocation {
+				de.TrafficAllocation = append(de.TrafficAllocation, debugTrafficAllocation{
+					Variation:  allocation.Variation.Key,
+					EndOfRange: allocation.endOfRange,
+				})
+			}
+			dp.Experiments = append(dp.Experiments, de)
+		}
+		sort.Slice(dp.Experiments, func(i, j int) bool { return dp.Experiments[i].Key < dp.Experiments[j].Key })
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
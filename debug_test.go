@@ -0,0 +1,165 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugHandler(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "projectId": "1234",
+  "accountId": "00001",
+  "revision": "666",
+  "experiments": [
+    {
+      "status": "Running",
+      "variations": [
+        {
+          "id": "abc123",
+          "key": "variation_1"
+        },
+        {
+          "id": "def456",
+          "key": "variation_2"
+        }
+      ],
+      "id": "5678",
+      "key": "an_experiment",
+      "layerId": "layer",
+      "trafficAllocation": [
+        {
+          "entityId": "abc123",
+          "endOfRange": 3000
+        },
+        {
+          "entityId": "def456",
+          "endOfRange": 10000
+        }
+      ],
+      "forcedVariations": {}
+    },
+    {
+      "status": "Paused",
+      "variations": [],
+      "id": "9012",
+      "key": "another_experiment",
+      "layerId": "layer_2",
+      "trafficAllocation": [],
+      "forcedVariations": {}
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	handler := DebugHandler(func() Project { return project })
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/optimizely", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var dp debugProject
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&dp))
+	assert.Equal(
+		t,
+		debugProject{
+			Version:   "4",
+			Revision:  "666",
+			ProjectID: "1234",
+			AccountID: "00001",
+			Experiments: []debugExperiment{
+				{
+					ID:         "5678",
+					Key:        "an_experiment",
+					Status:     "Running",
+					Variations: []string{"variation_1", "variation_2"},
+					TrafficAllocation: []debugTrafficAllocation{
+						{Variation: "variation_1", EndOfRange: 3000},
+						{Variation: "variation_2", EndOfRange: 10000},
+					},
+				}, {
+					ID:                "9012",
+					Key:               "another_experiment",
+					Status:            "Paused",
+					Variations:        []string{},
+					TrafficAllocation: []debugTrafficAllocation{},
+				},
+			},
+		},
+		dp,
+	)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/debug/optimizely", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestDebugHandler_concurrentSwaps(t *testing.T) {
+	newProject := func(revision string) Project {
+		project, err := NewProjectFromDataFile([]byte(`{"version": "4", "revision": "` + revision + `", "experiments": [
+			{"id": "` + revision + `", "key": "experiment_` + revision + `", "status": "Running"}]}`))
+		require.NoError(t, err)
+		return project
+	}
+	var current atomic.Value
+	current.Store(newProject("1"))
+	handler := DebugHandler(func() Project { return current.Load().(Project) })
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 2; i < 50; i++ {
+			current.Store(newProject(fmt.Sprint(i)))
+		}
+		close(done)
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/optimizely", nil))
+				var dp debugProject
+				if !assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&dp)) {
+					return
+				}
+				// each response is built from a single project
+				if assert.Len(t, dp.Experiments, 1) {
+					assert.Equal(t, "experiment_"+dp.Revision, dp.Experiments[0].Key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import "time"
+
+// DecisionOption configures how GetVariationWithOptions decides the variation of a user.
+type DecisionOption func(*decisionOptions)
+
+type decisionOptions struct {
+	bucketingID      string
+	timestamp        time.Time
+	forcedVariations map[string]string
+}
+
+// BucketingID buckets the user by the given ID instead of the user ID, e.g. to bucket every user of
+// an account into the same variation while reporting impressions for each user. Forced variations
+// and variations previously decided for the user, which are cached and saved to the decision store by
+// user ID, take precedence over bucketing.
+func BucketingID(id string) DecisionOption {
+	return func(o *decisionOptions) {
+		o.bucketingID = id
+	}
+}
+
+// DecisionTime stamps the impression with the given time instead of the current time, like
+// GetVariationAt.
+func DecisionTime(timestamp time.Time) DecisionOption {
+	return func(o *decisionOptions) {
+		o.timestamp = timestamp
+	}
+}
+
+// ForcedVariations decides the given variations, provided as a map of experiment key to variation
+// key, instead of bucketing the user, like WithForcedVariations does for GetVariation with a context.
+// Overrides only apply to running experiments and overrides for unknown variations are ignored.
+func ForcedVariations(overrides map[string]string) DecisionOption {
+	return func(o *decisionOptions) {
+		o.forcedVariations = overrides
+	}
+}
+
+// GetVariationWithOptions is like GetVariation but accepts options that change how the variation is
+// decided, which keeps GetVariation simple for the common case. Without options, it is equivalent to
+// GetVariation.
+func (p Project) GetVariationWithOptions(experimentName, userID string, options ...DecisionOption) *Impression {
+	o := decisionOptions{bucketingID: userID, timestamp: time.Now()}
+	for _, option := range options {
+		option(&o)
+	}
+	if variationKey, ok := o.forcedVariations[experimentName]; ok {
+		if impression := p.getOverriddenVariation(experimentName, variationKey, userID); impression != nil {
+			impression.Timestamp = o.timestamp
+			return impression
+		}
+	}
+	return p.getVariation(experimentName, userID, o.bucketingID, o.timestamp)
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import "golang.org/x/xerrors"
+
+// DecisionStore persists the variations that users have been bucketed into, e.g. in Redis, so that
+// bucketing decisions survive restarts and are shared by every instance of a service. Bucketing is
+// deterministic, so a store is only needed to keep users in their variation after the traffic
+// allocation of an experiment changes. Implementations must be safe for concurrent use.
+type DecisionStore interface {
+	// Lookup returns the key of the variation of the experiment that the user was previously
+	// bucketed into, or an empty string if the user has not been bucketed into the experiment.
+	Lookup(userID, experimentKey string) (string, error)
+	// Save records the key of the variation of the experiment that the user was bucketed into.
+	Save(userID, experimentKey, variationKey string) error
+}
+
+// SetDecisionStore makes GetVariation return the variation recorded in the store for a user, if
+// any, and record the variation of every user that it buckets. Variations are still cached in
+// memory, so the store is only consulted the first time a user is seen by the project. Errors from
+// the store never fail bucketing: when a lookup fails the user is bucketed as if there were no
+// store and when a save fails the variation is still returned. The errors are passed to onError,
+// if it is not nil, e.g. for logging. The store must be set before the project is used.
+func (p *Project) SetDecisionStore(store DecisionStore, onError func(error)) {
+	p.decisionStore = store
+	p.onDecisionStoreError = onError
+}
+
+// storedVariation returns the variation of the experiment recorded in the decision store for the
+// user. False is returned if there is no store, no recorded variation, or the recorded variation
+// no longer exists.
+func (p Project) storedVariation(experiment Experiment, userID string) (Variation, bool) {
+	if p.decisionStore == nil {
+		return Variation{}, false
+	}
+	variationKey, err := p.decisionStore.Lookup(userID, experiment.Key)
+	if err != nil {
+		p.decisionStoreError(xerrors.Errorf(
+			"error looking up variation of experiment %v for user %v: %w", experiment.Key, userID, err))
+		return Variation{}, false
+	}
+	variation, ok := experiment.variations[variationKey]
+	return variation, ok
+}
+
+// storeVariation records the variation of the experiment for the user in the decision store, if any.
+func (p Project) storeVariation(experiment Experiment, userID string, variation Variation) {
+	if p.decisionStore == nil {
+		return
+	}
+	if err := p.decisionStore.Save(userID, experiment.Key, variation.Key); err != nil {
+		p.decisionStoreError(xerrors.Errorf(
+			"error saving variation of experiment %v for user %v: %w", experiment.Key, userID, err))
+	}
+}
+
+func (p Project) decisionStoreError(err error) {
+	if p.onDecisionStoreError != nil {
+		p.onDecisionStoreError(err)
+	}
+}
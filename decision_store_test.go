@@ -0,0 +1,143 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// fakeDecisionStore is an in-memory stand-in for a distributed store such as Redis
+type fakeDecisionStore struct {
+	decisions map[string]string
+	lookupErr error
+	saveErr   error
+	lookups   int
+	mutex     sync.Mutex
+}
+
+func (s *fakeDecisionStore) Lookup(userID, experimentKey string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lookups++
+	if s.lookupErr != nil {
+		return "", s.lookupErr
+	}
+	return s.decisions[userID+"/"+experimentKey], nil
+}
+
+func (s *fakeDecisionStore) Save(userID, experimentKey, variationKey string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.decisions[userID+"/"+experimentKey] = variationKey
+	return nil
+}
+
+func TestProject_SetDecisionStore(t *testing.T) {
+	storeErr := fmt.Errorf("connection refused")
+	tests := []struct {
+		name              string
+		stored            map[string]string
+		lookupErr         error
+		saveErr           error
+		expectedVariation string
+		expectedStored    map[string]string
+		expectedErr       bool
+	}{
+		{
+			"stored decision takes precedence over bucketing",
+			map[string]string{"user/exp": "a"},
+			nil,
+			nil,
+			"a",
+			map[string]string{"user/exp": "a"},
+			false,
+		}, {
+			"bucketed decision is saved",
+			map[string]string{},
+			nil,
+			nil,
+			"b",
+			map[string]string{"user/exp": "b"},
+			false,
+		}, {
+			"stored decision for a removed variation is replaced",
+			map[string]string{"user/exp": "removed"},
+			nil,
+			nil,
+			"b",
+			map[string]string{"user/exp": "b"},
+			false,
+		}, {
+			"lookup error falls back to bucketing",
+			map[string]string{},
+			storeErr,
+			nil,
+			"b",
+			map[string]string{"user/exp": "b"},
+			true,
+		}, {
+			"save error still returns the variation",
+			map[string]string{},
+			nil,
+			storeErr,
+			"b",
+			map[string]string{},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			experiment := Experiment{
+				Key:              "exp",
+				id:               "1",
+				status:           runningStatus,
+				variations:       map[string]Variation{"a": {id: "a", Key: "a"}, "b": {id: "b", Key: "b"}},
+				forcedVariations: map[string]Variation{},
+				// all traffic is allocated to b, so any other variation must come from the store
+				trafficAllocation: []trafficAllocation{{endOfRange: 10000, Variation: Variation{id: "b", Key: "b"}}},
+				cachedVariations:  map[string]Variation{},
+				mutex:             &sync.RWMutex{},
+			}
+			p := Project{experiments: map[string]Experiment{"exp": experiment}}
+			store := &fakeDecisionStore{decisions: test.stored, lookupErr: test.lookupErr, saveErr: test.saveErr}
+			errs := make([]error, 0)
+			p.SetDecisionStore(store, func(err error) { errs = append(errs, err) })
+
+			impression := p.GetVariation("exp", "user")
+			require.NotNil(t, impression)
+			assert.Equal(t, test.expectedVariation, impression.Key)
+			assert.Equal(t, test.expectedStored, store.decisions)
+			if test.expectedErr {
+				require.Len(t, errs, 1)
+				assert.True(t, xerrors.Is(errs[0], storeErr))
+			} else {
+				assert.Len(t, errs, 0)
+			}
+
+			// subsequent lookups are served from memory
+			assert.Equal(t, test.expectedVariation, p.GetVariation("exp", "user").Key)
+			assert.Equal(t, 1, store.lookups)
+		})
+	}
+}
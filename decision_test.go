@@ -0,0 +1,148 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProject_GetVariationWithOptions(t *testing.T) {
+	// user2 and user3 are bucketed into variations 1 and 2, respectively
+	datafile := []byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "id": "2",
+      "key": "an_experiment",
+      "status": "Running",
+      "variations": [{"id": "1", "key": "variation_1"}, {"id": "2", "key": "variation_2"}],
+      "trafficAllocation": [{"entityId": "1", "endOfRange": 5000}, {"entityId": "2", "endOfRange": 10000}],
+      "forcedVariations": {"forced_user": "variation_2"}
+    },
+    {
+      "id": "3",
+      "key": "paused_experiment",
+      "status": "Paused",
+      "variations": [{"id": "3", "key": "variation_1"}],
+      "trafficAllocation": [{"entityId": "3", "endOfRange": 10000}]
+    }
+  ]
+}
+`)
+	timestamp := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		experimentKey     string
+		userID            string
+		options           []DecisionOption
+		expectedVariation string
+	}{
+		{"no options", "an_experiment", "user2", nil, "variation_1"},
+		{
+			"bucketing ID and timestamp",
+			"an_experiment",
+			"user2",
+			[]DecisionOption{BucketingID("user3"), DecisionTime(timestamp)},
+			"variation_2",
+		}, {
+			"forced variation, bucketing ID, and timestamp",
+			"an_experiment",
+			"user3",
+			[]DecisionOption{
+				BucketingID("user3"),
+				ForcedVariations(map[string]string{"an_experiment": "variation_1"}),
+				DecisionTime(timestamp),
+			},
+			"variation_1",
+		}, {
+			"forced variations of other experiments are ignored",
+			"an_experiment",
+			"user2",
+			[]DecisionOption{
+				ForcedVariations(map[string]string{"other_experiment": "variation_2"}),
+				DecisionTime(timestamp),
+			},
+			"variation_1",
+		}, {
+			"unknown forced variation",
+			"an_experiment",
+			"user2",
+			[]DecisionOption{ForcedVariations(map[string]string{"an_experiment": "unknown"}), DecisionTime(timestamp)},
+			"variation_1",
+		}, {
+			"datafile forced variations take precedence over the bucketing ID",
+			"an_experiment",
+			"forced_user",
+			[]DecisionOption{BucketingID("user2"), DecisionTime(timestamp)},
+			"variation_2",
+		}, {
+			"forced variations do not apply to experiments that are not running",
+			"paused_experiment",
+			"user2",
+			[]DecisionOption{ForcedVariations(map[string]string{"paused_experiment": "variation_1"})},
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project, err := NewProjectFromDataFile(datafile)
+			require.NoError(t, err)
+			before := time.Now()
+			impression := project.GetVariationWithOptions(test.experimentKey, test.userID, test.options...)
+			if test.expectedVariation == "" {
+				assert.Nil(t, impression)
+				return
+			}
+			require.NotNil(t, impression)
+			assert.Equal(t, test.expectedVariation, impression.Key)
+			assert.Equal(t, test.userID, impression.UserID)
+			if len(test.options) == 0 {
+				assert.False(t, impression.Timestamp.Before(before))
+			} else {
+				assert.Equal(t, timestamp, impression.Timestamp)
+			}
+		})
+	}
+}
+
+func TestProject_GetVariationWithOptions_cachedByUserID(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "id": "2",
+      "key": "an_experiment",
+      "status": "Running",
+      "variations": [{"id": "1", "key": "variation_1"}, {"id": "2", "key": "variation_2"}],
+      "trafficAllocation": [{"entityId": "1", "endOfRange": 5000}, {"entityId": "2", "endOfRange": 10000}]
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	impression := project.GetVariationWithOptions("an_experiment", "user2", BucketingID("user3"))
+	require.NotNil(t, impression)
+	assert.Equal(t, "variation_2", impression.Key)
+	// the user keeps the variation decided with the bucketing ID
+	impression = project.GetVariation("an_experiment", "user2")
+	require.NotNil(t, impression)
+	assert.Equal(t, "variation_2", impression.Key)
+}
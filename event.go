@@ -17,11 +17,13 @@ package optimizely
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"io"
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/spothero/optimizely-sdk-go/api"
+	"github.com/spothero/optimizely-sdk-go/internal/version"
 	"golang.org/x/xerrors"
 )
 
@@ -30,6 +32,11 @@ type event struct {
 	Type      string `json:"type"`
 	Timestamp int64  `json:"timestamp"`
 	UUID      string `json:"uuid"`
+	// the following are only set for conversions
+	Key     string                 `json:"key,omitempty"`
+	Revenue *int64                 `json:"revenue,omitempty"`
+	Value   *float64               `json:"value,omitempty"`
+	Tags    map[string]interface{} `json:"tags,omitempty"`
 }
 
 type decision struct {
@@ -52,23 +59,57 @@ type eventBatch struct {
 	AccountID       string    `json:"account_id"`
 	AnonymizeIP     bool      `json:"anonymize_ip"`
 	ClientName      string    `json:"client_name"`
+	ClientEngine    string    `json:"client_engine,omitempty"`
 	ClientVersion   *string   `json:"client_version,omitempty"`
 	EnrichDecisions bool      `json:"enrich_decisions"`
 	Visitors        []visitor `json:"visitors"`
+	// not part of the Optimizely schema; only sent when requested for forwarders that measure reporting lag
+	SendTimestamp *int64 `json:"send_timestamp,omitempty"`
+	// datafile revision of the activated impressions; only sent when requested with SendRevision
+	Revision *string `json:"revision,omitempty"`
+	// when set, an empty client version is reported as "" instead of being omitted
+	keepEmptyClientVersion bool
+	// datafile revision of the first activated impression; nil until an impression is added
+	revision *string
+	// set when the activated impressions are from more than one datafile revision
+	mixedRevisions bool
+	// when set, the revision of the activated impressions is reported in Revision
+	sendRevision bool
+	// maximum number of events reported for each visitor; zero means no limit
+	maxEventsPerVisitor int
+	// number of events dropped because their visitor exceeded maxEventsPerVisitor
+	dropped int
+	// data residency region that the events are reported to
+	region string
+	// when set, the region is not taken from the projects of activated impressions
+	regionOverridden bool
 }
 
-// Events are reportable actions back to the Optimizely API. Currently only
-// impression events are supported.
+// Events are reportable actions back to the Optimizely API: impressions of
+// variations and conversions of tracked events.
 type Events eventBatch
 
 // the default client name to report to Optimizely as well as
 // the path of this package that will be searched for in the importing
 // module's dependencies.
-const packagePath = "github.com/spothero/optimizely-sdk-go"
+const packagePath = version.ModulePath
 
-// Version of this library to report to Optimizely. If unset and the version
-// cannot be pulled out of the Go module info, it will not be sent.
-var clientVersion = ""
+// Version of this library to report to Optimizely. If the version cannot be
+// pulled out of the Go module info, it will not be sent.
+var clientVersion = version.Version
+
+// DefaultEnrichDecisions is the value of the enrich decisions property of events created by
+// NewEvents and EventsFromContext when the EnrichDecisions option is not provided. Set it to false
+// at startup when events are forwarded to a service that performs its own enrichment. This variable
+// must not be modified while events are being created.
+var DefaultEnrichDecisions = true
+
+// ErrNoVisitors is returned by NewEvents when the events would not contain any activated variations.
+var ErrNoVisitors = xerrors.New("cannot build event with no activated variations")
+
+// ErrMixedAccounts is returned by NewEvents when the activated variations are from more than one
+// Optimizely account.
+var ErrMixedAccounts = xerrors.New("activated variations must all be in the same account")
 
 // NewEvents constructs a set of reportable events from the provided options.
 func NewEvents(options ...func(*Events) error) (Events, error) {
@@ -76,38 +117,98 @@ func NewEvents(options ...func(*Events) error) (Events, error) {
 		ClientName:      packagePath,
 		ClientVersion:   &clientVersion,
 		AnonymizeIP:     true,
-		EnrichDecisions: true,
+		EnrichDecisions: DefaultEnrichDecisions,
 	}
 	for _, option := range options {
 		if err := option(&events); err != nil {
 			return Events{}, err
 		}
 	}
-	if *events.ClientVersion == "" {
+	if *events.ClientVersion == "" && !events.keepEmptyClientVersion {
 		events.ClientVersion = nil
 	}
 	if len(events.Visitors) == 0 {
-		return Events{}, fmt.Errorf("cannot build event with no activated variations")
+		return Events{}, ErrNoVisitors
+	}
+	if events.maxEventsPerVisitor > 0 {
+		events.capVisitorEvents()
+	}
+	// the revision is only known once every impression has been added, regardless of option order
+	if events.sendRevision && events.revision != nil && !events.mixedRevisions {
+		revision := *events.revision
+		events.Revision = &revision
 	}
 	return events, nil
 }
 
+// capVisitorEvents drops the events of each visitor beyond the first maxEventsPerVisitor, counting
+// them in dropped. Each activated impression is reported as a separate visitor with a single event,
+// so the visitors with the same ID are counted.
+func (e *Events) capVisitorEvents() {
+	counts := make(map[string]int)
+	kept := e.Visitors[:0]
+	for _, v := range e.Visitors {
+		counts[v.ID]++
+		if counts[v.ID] > e.maxEventsPerVisitor {
+			e.dropped++
+			continue
+		}
+		kept = append(kept, v)
+	}
+	e.Visitors = kept
+}
+
+// Dropped returns the number of events that were dropped because their visitor exceeded the limit
+// set with MaxEventsPerVisitor.
+func (e Events) Dropped() int {
+	return e.dropped
+}
+
+// NewEventsFromImpressions constructs a set of reportable events from impressions that were
+// collected by the caller, e.g. from a queue, rather than in a context. It is equivalent to
+// calling NewEvents with an ActivatedImpression option for each impression after the provided
+// options, so the impressions must all be from the same account. ErrNoVisitors is returned if there are no impressions.
+func NewEventsFromImpressions(impressions []Impression, options ...func(*Events) error) (Events, error) {
+	return newEventsFromImpressions(impressions, options)
+}
+
 // ActivatedImpression adds the variation impression to the set of reported events. Note that
 // while many impressions can be added as events, each impression must have originated from
 // the same Optimizely account or an error will be returned while creating the events.
 func ActivatedImpression(i Impression) func(*Events) error {
 	return func(e *Events) error {
-		if e.AccountID == "" {
-			e.AccountID = i.experiment.project.AccountID
-		} else if e.AccountID != i.experiment.project.AccountID {
-			return fmt.Errorf("activated variations must all be in the same account")
+		if err := e.addProject(i.owner().project); err != nil {
+			return err
 		}
 		e.Visitors = append(e.Visitors, i.toVisitor())
 		return nil
 	}
 }
 
-// EnrichDecisions sets the enrich decisions property on the events. Defaults to true.
+// addProject checks that the project of an added impression or tracked event has the same account as
+// the previously added ones, records whether its datafile revision differs from theirs, and takes the
+// region of the events from it unless the region was overridden.
+func (e *Events) addProject(project *Project) error {
+	if e.AccountID == "" {
+		e.AccountID = project.AccountID
+	} else if e.AccountID != project.AccountID {
+		return xerrors.Errorf(
+			"found accounts %v and %v: %w", e.AccountID, project.AccountID, ErrMixedAccounts)
+	}
+	revision := project.Revision
+	if e.revision == nil {
+		e.revision = &revision
+	} else if *e.revision != revision {
+		e.mixedRevisions = true
+	}
+	if !e.regionOverridden {
+		e.region = project.Region
+	}
+	return nil
+}
+
+// EnrichDecisions sets the enrich decisions property on the events. Defaults to DefaultEnrichDecisions,
+// which is true unless changed.
 func EnrichDecisions(enrich bool) func(*Events) error {
 	return func(e *Events) error {
 		e.EnrichDecisions = enrich
@@ -125,6 +226,16 @@ func ClientName(name string) func(*Events) error {
 	}
 }
 
+// ClientEngine sets the client engine property on the events, which identifies the SDK language or
+// platform separately from the client name, e.g. for forwarders that classify traffic by SDK. By
+// default, no client engine is reported.
+func ClientEngine(engine string) func(*Events) error {
+	return func(e *Events) error {
+		e.ClientEngine = engine
+		return nil
+	}
+}
+
 // ClientVersion overrides the client version of this library. If using Go 1.12+
 // and Go modules, the version of this library will be extracted from the build
 // information. Otherwise, unless ClientVersion is set here, no version will
@@ -136,6 +247,62 @@ func ClientVersion(version string) func(*Events) error {
 	}
 }
 
+// SendTimestamp stamps the events with a batch-level timestamp, in milliseconds since the epoch,
+// read from the provided clock when the events are built. Optimizely does not use this field,
+// but it allows forwarders to measure the lag between building and receiving the events. By
+// default, no batch-level timestamp is sent.
+func SendTimestamp(clock func() time.Time) func(*Events) error {
+	return func(e *Events) error {
+		timestamp := toEpochMillis(clock())
+		e.SendTimestamp = &timestamp
+		return nil
+	}
+}
+
+// SendRevision sets whether the events report the revision of the datafile that the activated
+// impressions were created from, which helps correlate events with the datafile that produced them,
+// e.g. when investigating assignment discrepancies after the datafile changes. The revision is not
+// sent if the impressions are from more than one revision; use EventsByRevisionFromContext to report
+// the impressions of a context in one batch per revision. By default, the revision is not sent.
+func SendRevision(send bool) func(*Events) error {
+	return func(e *Events) error {
+		e.sendRevision = send
+		return nil
+	}
+}
+
+// MaxEventsPerVisitor limits the number of events reported for each visitor, e.g. as a safety valve
+// against a bug that records an impression for the same user in a loop. The first max events of each
+// visitor are kept and the rest are dropped; the number of dropped events is available from
+// Events.Dropped. The limit applies to all activated impressions, regardless of the order of the
+// options. By default, there is no limit.
+func MaxEventsPerVisitor(max int) func(*Events) error {
+	return func(e *Events) error {
+		e.maxEventsPerVisitor = max
+		return nil
+	}
+}
+
+// OmitEmptyClientVersion controls whether an empty client version is omitted
+// from the reported events or sent as an empty string. Defaults to true.
+func OmitEmptyClientVersion(omit bool) func(*Events) error {
+	return func(e *Events) error {
+		e.keepEmptyClientVersion = !omit
+		return nil
+	}
+}
+
+// Region sets the data residency region, e.g. api.RegionEU, whose events API the events are reported
+// to by ReportEvents, ReportEventsWithRetry, and Reporter. Defaults to the region of the datafile of
+// the activated impressions.
+func Region(region string) func(*Events) error {
+	return func(e *Events) error {
+		e.region = region
+		e.regionOverridden = true
+		return nil
+	}
+}
+
 // AnonymizeIP sets the anonymize IP flag on the events. Defaults to true.
 func AnonymizeIP(anonymize bool) func(*Events) error {
 	return func(e *Events) error {
@@ -144,18 +311,26 @@ func AnonymizeIP(anonymize bool) func(*Events) error {
 	}
 }
 
+// toEpochMillis converts a time to the number of milliseconds since the Unix epoch, the unit of
+// all timestamps sent to the Optimizely API. Times before the epoch are rounded down to the
+// previous millisecond, like times after it, rather than towards zero.
+func toEpochMillis(t time.Time) int64 {
+	return t.Unix()*int64(time.Second/time.Millisecond) + int64(t.Nanosecond())/int64(time.Millisecond)
+}
+
 // toVisitor converts an impression to the visitor data structure for sending
 // to the Optimizely API.
 func (v Impression) toVisitor() visitor {
+	experiment := v.owner()
 	dec := decision{
-		CampaignID:   v.experiment.layerID,
-		ExperimentID: v.experiment.id,
+		CampaignID:   experiment.layerID,
+		ExperimentID: experiment.id,
 		VariationID:  v.id,
 	}
 	ev := event{
-		EntityID:  v.experiment.layerID,
+		EntityID:  experiment.layerID,
 		Type:      "campaign_activated",
-		Timestamp: v.Timestamp.UTC().UnixNano() / int64(time.Millisecond/time.Nanosecond),
+		Timestamp: toEpochMillis(v.Timestamp),
 		UUID:      uuid.New().String(),
 	}
 	return visitor{
@@ -174,38 +349,143 @@ func (v Impression) toVisitor() visitor {
 // NewEvents with the exception that the ActivatedImpression function
 // should never be provided as an option and may result in a panic if
 // the provided impression was created by a project in a different account from
-// the project stored in the context.
+// the project stored in the context. Use EventsFromContextE to receive the
+// error instead of a panic.
+//
+// If the datafile was reloaded while the context was in use, the impressions
+// may be from more than one datafile revision and are all reported in the same
+// events. Use EventsByRevisionFromContext to report them in one batch per revision.
 func EventsFromContext(ctx context.Context, options ...func(*Events) error) *Events {
+	// There can never be an error here when this API is used correctly because
+	// there are only two cases that can cause an error: no impressions, and
+	// impressions from different projects. We know that there are impressions
+	// because the case of no impressions is handled by EventsFromContextE, and we
+	// know that all impressions are from the same project because they had to be
+	// inserted into the context by the same project. Thus, the only way an error
+	// can occur here is if the API is misused and an impression from
+	// a different project was passed as an additional option to this
+	// function.
+	events, err := EventsFromContextE(ctx, options...)
+	if err != nil {
+		panic(err)
+	}
+	return events
+}
+
+// EventsFromContextE is like EventsFromContext but returns an error instead of panicking when the
+// events cannot be created, e.g. because an ActivatedImpression option from a different account was
+// provided. The impressions recorded in the context are only cleared if the events were created.
+func EventsFromContextE(ctx context.Context, options ...func(*Events) error) (*Events, error) {
 	projectCtx, ok := ctx.Value(projCtxKey).(*projectContext)
 	if !ok {
-		return nil
+		return nil, nil
 	}
 	projectCtx.mutex.Lock()
 	defer projectCtx.mutex.Unlock()
 	if len(projectCtx.impressions) == 0 {
-		return nil
+		return nil, nil
+	}
+	events, err := newEventsFromImpressions(projectCtx.impressions, options)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating events from context: %w", err)
 	}
+
+	// reset impressions in case the project context gets reused
+	projectCtx.impressions = make([]Impression, 0)
+
+	return &events, nil
+}
+
+// EventsByRevisionFromContext is like EventsFromContextE, but creates one set of events for each
+// datafile revision of the impressions that were seen during the lifecycle of the provided context,
+// in the order in which the first impression of each revision was recorded. Impressions from
+// different revisions, e.g. when the datafile was reloaded while the context was in use, may
+// reference experiments or variations that no longer exist, so reporting them separately keeps the
+// decisions of each batch consistent with a single datafile. The options are applied to every set of
+// events. The impressions recorded in the context are only cleared if all the events were created.
+func EventsByRevisionFromContext(ctx context.Context, options ...func(*Events) error) ([]*Events, error) {
+	projectCtx, ok := ctx.Value(projCtxKey).(*projectContext)
+	if !ok {
+		return nil, nil
+	}
+	projectCtx.mutex.Lock()
+	defer projectCtx.mutex.Unlock()
+	if len(projectCtx.impressions) == 0 {
+		return nil, nil
+	}
+	revisions := make([]string, 0, 1)
+	impressionsByRevision := make(map[string][]Impression)
 	for _, impression := range projectCtx.impressions {
-		options = append(options, ActivatedImpression(impression))
+		revision := impression.Revision()
+		if _, ok := impressionsByRevision[revision]; !ok {
+			revisions = append(revisions, revision)
+		}
+		impressionsByRevision[revision] = append(impressionsByRevision[revision], impression)
 	}
-	// There can never be an error here when this API is used correctly because
-	// there are only two cases that can cause an error: no impressions, and
-	// impressions from different projects. We know that there are impressions
-	// because the case of no impressions is handled above, and we know that all
-	// impressions are from the same project because they had to be inserted
-	// into the context by the same project. Thus, the only way an error
-	// can occur here is if the API is misused and an impression from
-	// a different project was passed as an additional option to this
-	// function.
-	events, err := NewEvents(options...)
-	if err != nil {
-		panic(err)
+	batches := make([]*Events, 0, len(revisions))
+	for _, revision := range revisions {
+		events, err := newEventsFromImpressions(impressionsByRevision[revision], options)
+		if err != nil {
+			return nil, xerrors.Errorf("error creating events from context for revision %v: %w", revision, err)
+		}
+		batches = append(batches, &events)
 	}
 
 	// reset impressions in case the project context gets reused
 	projectCtx.impressions = make([]Impression, 0)
 
-	return &events
+	return batches, nil
+}
+
+// newEventsFromImpressions creates events from the impressions after the provided options, without
+// modifying the options.
+func newEventsFromImpressions(impressions []Impression, options []func(*Events) error) (Events, error) {
+	allOptions := make([]func(*Events) error, 0, len(options)+len(impressions))
+	allOptions = append(allOptions, options...)
+	for _, impression := range impressions {
+		allOptions = append(allOptions, ActivatedImpression(impression))
+	}
+	return NewEvents(allOptions...)
+}
+
+// ImpressionsFromContext returns a copy of the impressions that have been recorded in the
+// provided context without clearing them, unlike EventsFromContext. This allows impressions
+// to be inspected, e.g. for logging, before or after events are built from them. Use
+// ClearImpressions to clear the recorded impressions. If no project was found in the context,
+// nil is returned.
+func ImpressionsFromContext(ctx context.Context) []Impression {
+	projectCtx, ok := ctx.Value(projCtxKey).(*projectContext)
+	if !ok {
+		return nil
+	}
+	projectCtx.mutex.Lock()
+	defer projectCtx.mutex.Unlock()
+	impressions := make([]Impression, len(projectCtx.impressions))
+	copy(impressions, projectCtx.impressions)
+	return impressions
+}
+
+// ClearImpressions clears the impressions that have been recorded in the provided context.
+func ClearImpressions(ctx context.Context) {
+	projectCtx, ok := ctx.Value(projCtxKey).(*projectContext)
+	if !ok {
+		return
+	}
+	projectCtx.mutex.Lock()
+	defer projectCtx.mutex.Unlock()
+	projectCtx.impressions = make([]Impression, 0)
+}
+
+// WriteTo writes the events to w as the same JSON that is sent to the Optimizely reporting API,
+// which allows events to be captured for debugging or replay without reporting them. WriteTo
+// implements io.WriterTo.
+func (e Events) WriteTo(w io.Writer) (int64, error) {
+	eventsJSON, err := json.Marshal(e)
+	if err != nil {
+		return 0, xerrors.Errorf("error marshaling events to JSON: %w", err)
+	}
+	n, err := w.Write(eventsJSON)
+	return int64(n), err
 }
 
 // ReportEvents is a convenience wrapper for sending events to the Optimizely reporting API that marshals
@@ -219,5 +499,99 @@ func ReportEvents(client api.Client, events Events) error {
 		return xerrors.Errorf("error marshaling events to JSON: %w", err)
 	}
 	// the events endpoint does not require auth nor take any other parameters so just use the empty API client
-	return client.ReportEvents(eventsJSON)
+	return events.report(client, eventsJSON)
+}
+
+// report sends the serialized events to the events API of the region of the events.
+func (e Events) report(client api.Client, eventsJSON []byte) error {
+	if e.region == "" {
+		return client.ReportEvents(eventsJSON)
+	}
+	return client.ReportEventsForRegion(e.region, eventsJSON)
+}
+
+// retryPolicy controls how ReportEventsWithRetry retries failed requests to the events API.
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	deadLetter func(events []byte, err error)
+	sleep      func(time.Duration)
+}
+
+// RetryAttempts sets the maximum number of attempts, including the first, that ReportEventsWithRetry
+// makes to report events. Defaults to 3; values less than 1 are treated as 1.
+func RetryAttempts(attempts int) func(*retryPolicy) {
+	return func(p *retryPolicy) {
+		if attempts < 1 {
+			attempts = 1
+		}
+		p.attempts = attempts
+	}
+}
+
+// RetryBackoff sets the delay before the first retry made by ReportEventsWithRetry. The delay
+// doubles after every subsequent failed attempt. Defaults to 100ms.
+func RetryBackoff(backoff time.Duration) func(*retryPolicy) {
+	return func(p *retryPolicy) {
+		p.backoff = backoff
+	}
+}
+
+// DeadLetter sets a callback that ReportEventsWithRetry invokes with the serialized events and the
+// last error once all attempts to report the events have failed, or as soon as the events API
+// rejects the events with a status code that will not succeed on retry. The serialized events can be
+// persisted and later re-sent with the ReportEvents method of the api.Client, or with
+// ReportEventsForRegion if the events have a region.
+func DeadLetter(callback func(events []byte, err error)) func(*retryPolicy) {
+	return func(p *retryPolicy) {
+		p.deadLetter = callback
+	}
+}
+
+// ReportEventsWithRetry sends events to the Optimizely reporting API like ReportEvents, but retries
+// failed requests with exponential backoff to provide at-least-once delivery. The events are
+// serialized only once so that every attempt sends identical event UUIDs, allowing Optimizely to
+// deduplicate events that were received more than once. Events rejected by the events API with a
+// 4xx status code, other than 429 Too Many Requests, are not retried. If every attempt fails or the
+// events are rejected, the dead letter callback, if any, is invoked and the last error is returned.
+func ReportEventsWithRetry(client api.Client, events Events, options ...func(*retryPolicy)) error {
+	policy := retryPolicy{
+		attempts: 3,
+		backoff:  100 * time.Millisecond,
+		sleep:    time.Sleep,
+	}
+	for _, option := range options {
+		option(&policy)
+	}
+	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return xerrors.Errorf("error marshaling events to JSON: %w", err)
+	}
+	backoff := policy.backoff
+	attempt := 1
+	for ; ; attempt++ {
+		err = events.report(client, eventsJSON)
+		if err == nil {
+			return nil
+		}
+		if attempt >= policy.attempts || !retryable(err) {
+			break
+		}
+		policy.sleep(backoff)
+		backoff *= 2
+	}
+	if policy.deadLetter != nil {
+		policy.deadLetter(eventsJSON, err)
+	}
+	return xerrors.Errorf("failed to report events after %d attempts: %w", attempt, err)
+}
+
+// retryable returns whether a report that failed with the given error may succeed if retried.
+func retryable(err error) bool {
+	var statusErr *api.EventsStatusError
+	if !xerrors.As(err, &statusErr) {
+		return true
+	}
+	return statusErr.StatusCode < 400 || statusErr.StatusCode >= 500 ||
+		statusErr.StatusCode == http.StatusTooManyRequests
 }
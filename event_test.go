@@ -15,15 +15,21 @@
 package optimizely
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/spothero/optimizely-sdk-go/api"
 	"github.com/spothero/optimizely-sdk-go/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
 )
 
 // ensure that the visitor objects are equal by checking that the UUID
@@ -48,8 +54,11 @@ func assertEventsEqual(t *testing.T, expected, actual Events) {
 	assert.Equal(t, expected.AccountID, actual.AccountID)
 	assert.Equal(t, expected.AnonymizeIP, actual.AnonymizeIP)
 	assert.Equal(t, expected.ClientName, actual.ClientName)
+	assert.Equal(t, expected.ClientEngine, actual.ClientEngine)
 	assert.Equal(t, expected.ClientVersion, actual.ClientVersion)
 	assert.Equal(t, expected.EnrichDecisions, actual.EnrichDecisions)
+	assert.Equal(t, expected.SendTimestamp, actual.SendTimestamp)
+	assert.Equal(t, expected.Revision, actual.Revision)
 	assert.Equal(t, len(expected.Visitors), len(actual.Visitors))
 	for i := range expected.Visitors {
 		assertVisitorEqual(t, expected.Visitors[i], actual.Visitors[i])
@@ -91,6 +100,11 @@ func TestImpression_toVisitor(t *testing.T) {
 	)
 }
 
+func TestImpression_Revision(t *testing.T) {
+	impression := Impression{Variation: Variation{experiment: &Experiment{project: &Project{Revision: "42"}}}}
+	assert.Equal(t, "42", impression.Revision())
+}
+
 func TestNewEvents(t *testing.T) {
 	version := "version"
 	tests := []struct {
@@ -98,6 +112,7 @@ func TestNewEvents(t *testing.T) {
 		options        []func(*Events) error
 		expectedEvents Events
 		expectError    bool
+		expectedErr    error
 	}{
 		{
 			"events are created",
@@ -176,6 +191,7 @@ func TestNewEvents(t *testing.T) {
 				},
 			},
 			false,
+			nil,
 		}, {
 			"error returned when impressions are from different projects",
 			[]func(*Events) error{
@@ -200,11 +216,13 @@ func TestNewEvents(t *testing.T) {
 			},
 			Events{},
 			true,
+			ErrMixedAccounts,
 		}, {
 			"error returned when there are no visitors",
 			[]func(*Events) error{},
 			Events{},
 			true,
+			ErrNoVisitors,
 		}, {
 			"unset client version sets version to nil",
 			[]func(*Events) error{
@@ -235,6 +253,7 @@ func TestNewEvents(t *testing.T) {
 				},
 			},
 			false,
+			nil,
 		},
 	}
 	for _, test := range tests {
@@ -242,6 +261,9 @@ func TestNewEvents(t *testing.T) {
 			events, err := NewEvents(test.options...)
 			if test.expectError {
 				assert.Error(t, err)
+				if test.expectedErr != nil {
+					assert.True(t, xerrors.Is(err, test.expectedErr))
+				}
 				return
 			}
 			require.NoError(t, err)
@@ -250,6 +272,226 @@ func TestNewEvents(t *testing.T) {
 	}
 }
 
+func TestOmitEmptyClientVersion(t *testing.T) {
+	impression := ActivatedImpression(
+		Impression{
+			Variation: Variation{
+				experiment: &Experiment{
+					project: &Project{AccountID: "account"},
+				},
+			},
+		},
+	)
+	tests := []struct {
+		name          string
+		omit          bool
+		expectVersion bool
+	}{
+		{
+			"empty client version is omitted",
+			true,
+			false,
+		}, {
+			"empty client version is sent as an empty string",
+			false,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := NewEvents(impression, ClientVersion(""), OmitEmptyClientVersion(test.omit))
+			require.NoError(t, err)
+			eventsJSON, err := json.Marshal(events)
+			require.NoError(t, err)
+			var decoded map[string]interface{}
+			require.NoError(t, json.Unmarshal(eventsJSON, &decoded))
+			version, ok := decoded["client_version"]
+			assert.Equal(t, test.expectVersion, ok)
+			if test.expectVersion {
+				assert.Equal(t, "", version)
+			}
+		})
+	}
+}
+
+func TestClientEngine(t *testing.T) {
+	impression := ActivatedImpression(
+		Impression{
+			Variation: Variation{
+				experiment: &Experiment{
+					project: &Project{AccountID: "account"},
+				},
+			},
+		},
+	)
+	tests := []struct {
+		name          string
+		options       []func(*Events) error
+		expectEngine  bool
+		expectedValue string
+	}{
+		{"client engine is omitted by default", []func(*Events) error{impression}, false, ""},
+		{"client engine is sent when set", []func(*Events) error{impression, ClientEngine("go-sdk")}, true, "go-sdk"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := NewEvents(test.options...)
+			require.NoError(t, err)
+			eventsJSON, err := json.Marshal(events)
+			require.NoError(t, err)
+			var decoded map[string]interface{}
+			require.NoError(t, json.Unmarshal(eventsJSON, &decoded))
+			engine, ok := decoded["client_engine"]
+			assert.Equal(t, test.expectEngine, ok)
+			if test.expectEngine {
+				assert.Equal(t, test.expectedValue, engine)
+			}
+		})
+	}
+}
+
+func TestSendRevision(t *testing.T) {
+	impression := ActivatedImpression(
+		Impression{
+			Variation: Variation{
+				experiment: &Experiment{
+					project: &Project{AccountID: "account", Revision: "42"},
+				},
+			},
+		},
+	)
+	otherRevision := ActivatedImpression(
+		Impression{
+			Variation: Variation{
+				experiment: &Experiment{
+					project: &Project{AccountID: "account", Revision: "43"},
+				},
+			},
+		},
+	)
+	tests := []struct {
+		name           string
+		options        []func(*Events) error
+		expectRevision bool
+	}{
+		{"revision is omitted by default", []func(*Events) error{impression}, false},
+		{"revision is sent when requested", []func(*Events) error{SendRevision(true), impression}, true},
+		{"revision is omitted when disabled", []func(*Events) error{impression, SendRevision(false)}, false},
+		{
+			"revision is omitted when impressions are from different revisions",
+			[]func(*Events) error{SendRevision(true), impression, otherRevision},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := NewEvents(test.options...)
+			require.NoError(t, err)
+			eventsJSON, err := json.Marshal(events)
+			require.NoError(t, err)
+			var decoded map[string]interface{}
+			require.NoError(t, json.Unmarshal(eventsJSON, &decoded))
+			revision, ok := decoded["revision"]
+			assert.Equal(t, test.expectRevision, ok)
+			if test.expectRevision {
+				assert.Equal(t, "42", revision)
+			}
+		})
+	}
+}
+
+func TestMaxEventsPerVisitor(t *testing.T) {
+	project := &Project{AccountID: "account"}
+	impression := func(userID string) Impression {
+		return Impression{Variation: Variation{experiment: &Experiment{project: project}}, UserID: userID}
+	}
+	impressions := []Impression{impression("runaway"), impression("user"), impression("runaway")}
+	for i := 0; i < 5; i++ {
+		impressions = append(impressions, impression("runaway"))
+	}
+	tests := []struct {
+		name             string
+		options          []func(*Events) error
+		expectedVisitors []string
+		expectedDropped  int
+	}{
+		{
+			"no limit by default",
+			nil,
+			[]string{"runaway", "user", "runaway", "runaway", "runaway", "runaway", "runaway", "runaway"},
+			0,
+		}, {
+			"over-cap visitor is truncated",
+			[]func(*Events) error{MaxEventsPerVisitor(2)},
+			[]string{"runaway", "user", "runaway"},
+			5,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := NewEventsFromImpressions(impressions, test.options...)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedDropped, events.Dropped())
+			eventsJSON, err := json.Marshal(events)
+			require.NoError(t, err)
+			var decoded struct {
+				Visitors []struct {
+					ID string `json:"visitor_id"`
+				} `json:"visitors"`
+			}
+			require.NoError(t, json.Unmarshal(eventsJSON, &decoded))
+			visitorIDs := make([]string, 0, len(decoded.Visitors))
+			for _, v := range decoded.Visitors {
+				visitorIDs = append(visitorIDs, v.ID)
+			}
+			assert.Equal(t, test.expectedVisitors, visitorIDs)
+		})
+	}
+}
+
+func TestDefaultEnrichDecisions(t *testing.T) {
+	defer func() { DefaultEnrichDecisions = true }()
+	DefaultEnrichDecisions = false
+	impression := ActivatedImpression(
+		Impression{
+			Variation: Variation{
+				experiment: &Experiment{
+					project: &Project{AccountID: "account"},
+				},
+			},
+		},
+	)
+	events, err := NewEvents(impression)
+	require.NoError(t, err)
+	assert.False(t, events.EnrichDecisions)
+	events, err = NewEvents(impression, EnrichDecisions(true))
+	require.NoError(t, err)
+	assert.True(t, events.EnrichDecisions)
+}
+
+func TestSendTimestamp(t *testing.T) {
+	clock := func() time.Time { return time.Unix(30, 0) }
+	events, err := NewEvents(
+		ActivatedImpression(
+			Impression{
+				Variation: Variation{
+					experiment: &Experiment{
+						project: &Project{AccountID: "account"},
+					},
+				},
+				Timestamp: time.Unix(10, 0),
+			},
+		),
+		SendTimestamp(clock),
+	)
+	require.NoError(t, err)
+	eventsJSON, err := json.Marshal(events)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(eventsJSON, &decoded))
+	assert.Equal(t, float64(30*time.Second/time.Millisecond), decoded["send_timestamp"])
+}
+
 func TestEventsFromContext(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -325,6 +567,219 @@ func TestEventsFromContext(t *testing.T) {
 	}
 }
 
+func TestEventsFromContextE(t *testing.T) {
+	newCtx := func() (context.Context, *projectContext) {
+		projectCtx := &projectContext{
+			impressions: []Impression{{
+				Variation: Variation{experiment: &Experiment{project: &Project{AccountID: "account"}}},
+			}},
+		}
+		return context.WithValue(context.Background(), projCtxKey, projectCtx), projectCtx
+	}
+
+	// impressions from another account are an error rather than a panic
+	ctx, projectCtx := newCtx()
+	var events *Events
+	var err error
+	assert.NotPanics(t, func() {
+		events, err = EventsFromContextE(ctx, ActivatedImpression(
+			Impression{Variation: Variation{experiment: &Experiment{project: &Project{AccountID: "account_2"}}}},
+		))
+	})
+	assert.Nil(t, events)
+	assert.True(t, xerrors.Is(err, ErrMixedAccounts))
+	// the impressions are kept so that events can still be created from them
+	assert.Len(t, projectCtx.impressions, 1)
+
+	ctx, projectCtx = newCtx()
+	events, err = EventsFromContextE(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, events)
+	assert.Equal(t, "account", events.AccountID)
+	assert.Len(t, projectCtx.impressions, 0)
+
+	events, err = EventsFromContextE(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, events)
+}
+
+func TestEventsByRevisionFromContext(t *testing.T) {
+	oldRevision := &Experiment{id: "experiment", layerID: "layer", project: &Project{AccountID: "account", Revision: "1"}}
+	newRevision := &Experiment{id: "experiment", layerID: "layer", project: &Project{AccountID: "account", Revision: "2"}}
+	impression := func(experiment *Experiment, userID string) Impression {
+		return Impression{Variation: Variation{id: "variation", experiment: experiment}, UserID: userID}
+	}
+	visitorIDs := func(events *Events) []string {
+		ids := make([]string, 0, len(events.Visitors))
+		for _, v := range events.Visitors {
+			ids = append(ids, v.ID)
+		}
+		return ids
+	}
+	// the datafile was reloaded while the context was in use
+	recorded := []Impression{
+		impression(oldRevision, "a"), impression(newRevision, "b"), impression(oldRevision, "c"),
+	}
+	projectCtx := &projectContext{impressions: recorded}
+	ctx := context.WithValue(context.Background(), projCtxKey, projectCtx)
+
+	batches, err := EventsByRevisionFromContext(ctx, SendRevision(true))
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	assert.Equal(t, "1", *batches[0].Revision)
+	assert.Equal(t, []string{"a", "c"}, visitorIDs(batches[0]))
+	assert.Equal(t, "2", *batches[1].Revision)
+	assert.Equal(t, []string{"b"}, visitorIDs(batches[1]))
+	assert.Len(t, projectCtx.impressions, 0)
+
+	batches, err = EventsByRevisionFromContext(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, batches)
+
+	batches, err = EventsByRevisionFromContext(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, batches)
+
+	// impressions are kept if any of the events cannot be created
+	projectCtx.impressions = recorded
+	otherAccount := impression(&Experiment{project: &Project{AccountID: "other", Revision: "2"}}, "d")
+	_, err = EventsByRevisionFromContext(ctx, ActivatedImpression(otherAccount))
+	assert.True(t, xerrors.Is(err, ErrMixedAccounts))
+	assert.Len(t, projectCtx.impressions, 3)
+
+	// EventsFromContext reports the impressions of every revision together without a revision
+	var events *Events
+	require.NotPanics(t, func() { events = EventsFromContext(ctx, SendRevision(true)) })
+	require.NotNil(t, events)
+	assert.Nil(t, events.Revision)
+	assert.Equal(t, []string{"a", "b", "c"}, visitorIDs(events))
+	assert.Len(t, projectCtx.impressions, 0)
+}
+
+func TestNewEventsFromImpressions(t *testing.T) {
+	project := &Project{AccountID: "account", Revision: "1"}
+	experiment := &Experiment{id: "experiment", layerID: "layer", project: project}
+	impression := func(userID, variationID string) Impression {
+		return Impression{
+			Variation: Variation{id: variationID, experiment: experiment},
+			UserID:    userID,
+			Timestamp: time.Unix(1, 0),
+		}
+	}
+	visitorFor := func(userID, variationID string) visitor {
+		return visitor{
+			ID: userID,
+			Snapshots: []snapshot{{
+				Decisions: []decision{{CampaignID: "layer", ExperimentID: "experiment", VariationID: variationID}},
+				Events:    []event{{EntityID: "layer", Type: "campaign_activated", Timestamp: 1000}},
+			}},
+		}
+	}
+	tests := []struct {
+		name           string
+		impressions    []Impression
+		expectedEvents Events
+		expectedErr    error
+	}{
+		{
+			"events built from pre-collected impressions",
+			[]Impression{impression("user_1", "a"), impression("user_2", "b")},
+			Events{
+				AccountID: "account",
+				Visitors:  []visitor{visitorFor("user_1", "a"), visitorFor("user_2", "b")},
+			},
+			nil,
+		}, {
+			"impressions from different accounts",
+			[]Impression{
+				impression("user_1", "a"),
+				{Variation: Variation{experiment: &Experiment{project: &Project{AccountID: "other"}}}},
+			},
+			Events{},
+			ErrMixedAccounts,
+		}, {
+			"no impressions",
+			nil,
+			Events{},
+			ErrNoVisitors,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := NewEventsFromImpressions(
+				test.impressions, ClientName(""), ClientVersion(""), AnonymizeIP(false), EnrichDecisions(false))
+			if test.expectedErr != nil {
+				assert.True(t, xerrors.Is(err, test.expectedErr))
+				return
+			}
+			require.NoError(t, err)
+			assertEventsEqual(t, test.expectedEvents, events)
+		})
+	}
+}
+
+func TestEvents_WriteTo(t *testing.T) {
+	version := "version"
+	events, err := NewEvents(
+		ActivatedImpression(
+			Impression{
+				Variation: Variation{
+					id:  "variation",
+					Key: "key",
+					experiment: &Experiment{
+						layerID: "layer",
+						id:      "experiment",
+						project: &Project{AccountID: "account"},
+					},
+				},
+				UserID:    "user",
+				Timestamp: time.Unix(10, 0),
+			},
+		),
+		ClientVersion(version),
+	)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	n, err := events.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	var decoded Events
+	require.NoError(t, json.NewDecoder(&buf).Decode(&decoded))
+	assertEventsEqual(t, events, decoded)
+}
+
+func TestImpressionsFromContext(t *testing.T) {
+	assert.Nil(t, ImpressionsFromContext(context.Background()))
+	// clearing a context without a project is a no-op
+	ClearImpressions(context.Background())
+
+	impression := Impression{
+		Variation: Variation{experiment: &Experiment{project: &Project{AccountID: "account"}}},
+		UserID:    "user",
+		Timestamp: time.Unix(0, 0),
+	}
+	projectCtx := &projectContext{impressions: []Impression{impression}}
+	ctx := context.WithValue(context.Background(), projCtxKey, projectCtx)
+
+	// events can be built from the same impressions more than once
+	for i := 0; i < 2; i++ {
+		impressions := ImpressionsFromContext(ctx)
+		require.Equal(t, []Impression{impression}, impressions)
+		options := make([]func(*Events) error, 0, len(impressions))
+		for _, i := range impressions {
+			options = append(options, ActivatedImpression(i))
+		}
+		events, err := NewEvents(options...)
+		require.NoError(t, err)
+		require.Len(t, events.Visitors, 1)
+		assert.Equal(t, "user", events.Visitors[0].ID)
+	}
+
+	ClearImpressions(ctx)
+	assert.Empty(t, ImpressionsFromContext(ctx))
+	assert.Nil(t, EventsFromContext(ctx))
+}
+
 func TestReportEvents(t *testing.T) {
 	events := Events{
 		AccountID:       "1234",
@@ -339,3 +794,238 @@ func TestReportEvents(t *testing.T) {
 	assert.NoError(t, ReportEvents(client, events))
 	client.AssertExpectations(t)
 }
+
+func TestReportEvents_region(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "accountId": "1234",
+  "region": "EU",
+  "experiments": [
+    {
+      "status": "Running",
+      "id": "5678",
+      "key": "an_experiment",
+      "variations": [{"id": "abc123", "key": "variation_1"}],
+      "trafficAllocation": [{"entityId": "abc123", "endOfRange": 10000}]
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, api.RegionEU, project.Region)
+	impression := project.GetVariation("an_experiment", "user")
+	require.NotNil(t, impression)
+	tests := []struct {
+		name           string
+		options        []func(*Events) error
+		expectedRegion string
+	}{
+		{"region of the datafile is used", nil, api.RegionEU},
+		{"region can be overridden", []func(*Events) error{Region("US")}, "US"},
+		{"region can be cleared", []func(*Events) error{Region("")}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := NewEvents(append(test.options, ActivatedImpression(*impression))...)
+			require.NoError(t, err)
+			client := &mocks.Client{}
+			defer client.AssertExpectations(t)
+			if test.expectedRegion == "" {
+				client.On("ReportEvents", mock.Anything).Return(nil).Twice()
+			} else {
+				client.On("ReportEventsForRegion", test.expectedRegion, mock.Anything).Return(nil).Twice()
+			}
+			assert.NoError(t, ReportEvents(client, events))
+			assert.NoError(t, ReportEventsWithRetry(client, events, RetryAttempts(1)))
+		})
+	}
+}
+
+func TestImpression_JSON(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "accountId": "1234",
+  "revision": "42",
+  "region": "EU",
+  "experiments": [
+    {
+      "status": "Running",
+      "id": "5678",
+      "key": "an_experiment",
+      "layerId": "layer",
+      "variations": [{"id": "abc123", "key": "variation_1"}],
+      "trafficAllocation": [{"entityId": "abc123", "endOfRange": 10000}]
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	impressions := []Impression{
+		*project.GetVariation("an_experiment", "user_1"),
+		*project.GetVariation("an_experiment", "user_2"),
+	}
+	serialized, err := json.Marshal(impressions)
+	require.NoError(t, err)
+	var replayed []Impression
+	require.NoError(t, json.Unmarshal(serialized, &replayed))
+	require.Len(t, replayed, 2)
+	for i := range impressions {
+		assert.Equal(t, impressions[i].Key, replayed[i].Key)
+		assert.Equal(t, impressions[i].UserID, replayed[i].UserID)
+		assert.True(t, impressions[i].Timestamp.Equal(replayed[i].Timestamp))
+		assert.Equal(t, impressions[i].Revision(), replayed[i].Revision())
+	}
+
+	expected, err := NewEvents(ActivatedImpression(impressions[0]), ActivatedImpression(impressions[1]))
+	require.NoError(t, err)
+	actual, err := NewEvents(ActivatedImpression(replayed[0]), ActivatedImpression(replayed[1]))
+	require.NoError(t, err)
+	assertEventsEqual(t, expected, actual)
+
+	// the replayed events are reported like the original events
+	client := &mocks.Client{}
+	defer client.AssertExpectations(t)
+	client.On("ReportEventsForRegion", api.RegionEU, mock.Anything).Return(nil).Once()
+	assert.NoError(t, ReportEvents(client, actual))
+}
+
+func TestReportEventsWithRetry(t *testing.T) {
+	events := Events{
+		AccountID:       "1234",
+		AnonymizeIP:     true,
+		ClientName:      "client",
+		EnrichDecisions: true,
+	}
+	eventsJSON, err := json.Marshal(events)
+	require.NoError(t, err)
+	tests := []struct {
+		name               string
+		attempts           int
+		reportErr          error
+		failures           int
+		expectedSleeps     []time.Duration
+		expectErr          bool
+		expectedDeadLetter []byte
+	}{
+		{
+			"events are reported after two failed attempts",
+			3,
+			fmt.Errorf("api error"),
+			2,
+			[]time.Duration{time.Millisecond, 2 * time.Millisecond},
+			false,
+			nil,
+		}, {
+			"events are sent to the dead letter callback after all attempts fail",
+			3,
+			fmt.Errorf("api error"),
+			3,
+			[]time.Duration{time.Millisecond, 2 * time.Millisecond},
+			true,
+			eventsJSON,
+		}, {
+			"server errors are retried",
+			3,
+			&api.EventsStatusError{StatusCode: http.StatusServiceUnavailable},
+			1,
+			[]time.Duration{time.Millisecond},
+			false,
+			nil,
+		}, {
+			"too many requests errors are retried",
+			3,
+			&api.EventsStatusError{StatusCode: http.StatusTooManyRequests},
+			1,
+			[]time.Duration{time.Millisecond},
+			false,
+			nil,
+		}, {
+			"events rejected with a client error are sent to the dead letter callback without retrying",
+			3,
+			&api.EventsStatusError{StatusCode: http.StatusBadRequest},
+			1,
+			[]time.Duration{},
+			true,
+			eventsJSON,
+		}, {
+			"attempts less than 1 still make one attempt",
+			0,
+			fmt.Errorf("api error"),
+			1,
+			[]time.Duration{},
+			true,
+			eventsJSON,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &mocks.Client{}
+			client.On("ReportEvents", eventsJSON).Return(test.reportErr).Times(test.failures)
+			if !test.expectErr {
+				client.On("ReportEvents", eventsJSON).Return(nil).Once()
+			}
+			defer client.AssertExpectations(t)
+			var deadLetter []byte
+			sleeps := make([]time.Duration, 0)
+			err := ReportEventsWithRetry(
+				client,
+				events,
+				RetryAttempts(test.attempts),
+				RetryBackoff(time.Millisecond),
+				DeadLetter(func(events []byte, _ error) { deadLetter = events }),
+				func(p *retryPolicy) { p.sleep = func(d time.Duration) { sleeps = append(sleeps, d) } },
+			)
+			assert.Equal(t, test.expectedSleeps, sleeps)
+			assert.Equal(t, test.expectedDeadLetter, deadLetter)
+			if test.expectErr {
+				assert.True(t, xerrors.Is(err, test.reportErr))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestReportEventsWithRetry_tee(t *testing.T) {
+	events := Events{AccountID: "1234", ClientName: "client"}
+	eventsJSON, err := json.Marshal(events)
+	require.NoError(t, err)
+	primary := &mocks.Client{}
+	primary.On("ReportEventsForRegion", "", eventsJSON).Return(nil).Once()
+	defer primary.AssertExpectations(t)
+	secondary := &mocks.Client{}
+	secondary.On("ReportEventsForRegion", "", eventsJSON).Return(fmt.Errorf("secondary error")).Once()
+	defer secondary.AssertExpectations(t)
+	secondaryErrs := make([]error, 0)
+	client := api.Tee(primary, []api.Client{secondary}, api.SecondaryErrorHandler(func(err error) {
+		secondaryErrs = append(secondaryErrs, err)
+	}))
+
+	// with a secondary error handler, a failure of the secondary client alone is not retried, so the
+	// primary receives the events once
+	err = ReportEventsWithRetry(client, events, RetryAttempts(3), func(p *retryPolicy) { p.sleep = func(time.Duration) {} })
+	assert.NoError(t, err)
+	assert.Len(t, secondaryErrs, 1)
+}
+
+func TestToEpochMillis(t *testing.T) {
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected int64
+	}{
+		{"epoch is zero", time.Unix(0, 0), 0},
+		{"whole seconds are converted", time.Unix(10, 0), 10000},
+		{"sub-millisecond precision is truncated", time.Unix(1, int64(1500*time.Microsecond)), 1001},
+		{"time zone does not matter", time.Unix(10, 0).In(time.FixedZone("UTC-5", -5*60*60)), 10000},
+		{"pre-epoch whole milliseconds are converted", time.Unix(-1, int64(500*time.Millisecond)), -500},
+		{"pre-epoch sub-millisecond precision rounds down", time.Unix(0, -int64(1500*time.Microsecond)), -2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, toEpochMillis(test.time))
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import "time"
+
+// Feature is a feature flag of an Optimizely project. A feature is tested by its experiments and
+// rolled out by its rollout, if any.
+type Feature struct {
+	Key           string
+	id            string
+	experimentIDs []string
+	// keys of the experiments of experimentIDs that exist in the project, in the same order; resolved
+	// once the project's experiments are known so that deciding the feature does not search them
+	experimentKeys []string
+	rolloutID      string
+	project        *Project // backref to the owning project
+}
+
+// newFeature converts a feature flag from the datafile into a Feature belonging to the given project.
+func newFeature(f DatafileFeatureFlag, project *Project) Feature {
+	experimentIDs := make([]string, len(f.ExperimentIDs))
+	copy(experimentIDs, f.ExperimentIDs)
+	return Feature{
+		Key:           f.Key,
+		id:            f.ID,
+		experimentIDs: experimentIDs,
+		rolloutID:     f.RolloutID,
+		project:       project,
+	}
+}
+
+// GetFeature returns the feature flag with the given key and whether it exists in the project.
+func (p Project) GetFeature(key string) (Feature, bool) {
+	feature, ok := p.features[key]
+	return feature, ok
+}
+
+// resolveFeatureExperiments resolves the experiment IDs of every feature to the keys of the given
+// experiments. Features are decoded independently of experiments, which may follow them in the
+// datafile, so this is done once all the experiments of the project have been created.
+func resolveFeatureExperiments(features map[string]Feature, experiments map[string]Experiment) {
+	if len(features) == 0 {
+		return
+	}
+	keysByID := make(map[string]string, len(experiments))
+	for key, experiment := range experiments {
+		// experiment IDs are unique in valid datafiles; otherwise, the smallest key is used so that
+		// the result does not depend on the iteration order of the map
+		if existing, ok := keysByID[experiment.id]; !ok || key < existing {
+			keysByID[experiment.id] = key
+		}
+	}
+	for featureKey, feature := range features {
+		feature.experimentKeys = make([]string, 0, len(feature.experimentIDs))
+		for _, id := range feature.experimentIDs {
+			if key, ok := keysByID[id]; ok {
+				feature.experimentKeys = append(feature.experimentKeys, key)
+			}
+		}
+		features[featureKey] = feature
+	}
+}
+
+// Experiments returns the experiments of the project that test the feature, in the order in which
+// they are listed in the datafile. Experiments that are referenced by the feature but do not exist
+// in the project are omitted.
+func (f Feature) Experiments() []Experiment {
+	experiments := make([]Experiment, 0, len(f.experimentKeys))
+	if f.project == nil {
+		return experiments
+	}
+	for _, key := range f.experimentKeys {
+		experiments = append(experiments, f.project.experiments[key])
+	}
+	return experiments
+}
+
+// IsFeatureEnabled returns whether the feature with the given key is enabled for the user, along with
+// the impression of the feature's experiment that decided it. The experiments of the feature are
+// tried in order and the first experiment that the user is bucketed into decides whether the feature
+// is enabled, according to the feature enabled flag of the variation. The impression can be reported
+// like the impressions returned by GetVariation. If the user is not bucketed into any experiment of
+// the feature, false and a nil impression are returned. Rollouts are not supported, so features that
+// are only rolled out are never enabled.
+func (p Project) IsFeatureEnabled(featureKey, userID string) (bool, *Impression) {
+	feature, ok := p.features[featureKey]
+	if !ok {
+		return false, nil
+	}
+	timestamp := time.Now()
+	for _, key := range feature.experimentKeys {
+		if impression := p.decide(p.experiments[key], userID, userID, timestamp); impression != nil {
+			return impression.featureEnabled, impression
+		}
+	}
+	return false, nil
+}
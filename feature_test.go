@@ -0,0 +1,167 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProject_GetFeature(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {"id": "1", "key": "first_experiment", "status": "Running"},
+    {"id": "2", "key": "second_experiment", "status": "Running"}
+  ],
+  "groups": [
+    {"id": "g", "policy": "random", "experiments": [{"id": "3", "key": "grouped_experiment", "status": "Running"}]}
+  ],
+  "featureFlags": [
+    {
+      "id": "10",
+      "key": "checkout",
+      "experimentIds": ["3", "missing", "1"],
+      "rolloutId": "20",
+      "variables": [{"id": "30", "key": "color", "type": "string", "defaultValue": "red"}]
+    },
+    {"id": "11", "key": "search", "experimentIds": []}
+  ]
+}
+`))
+	require.NoError(t, err)
+
+	feature, ok := project.GetFeature("checkout")
+	require.True(t, ok)
+	assert.Equal(t, "checkout", feature.Key)
+	assert.Equal(t, "10", feature.id)
+	assert.Equal(t, "20", feature.rolloutID)
+	keys := make([]string, 0)
+	for _, experiment := range feature.Experiments() {
+		keys = append(keys, experiment.Key)
+	}
+	assert.Equal(t, []string{"grouped_experiment", "first_experiment"}, keys)
+
+	feature, ok = project.GetFeature("search")
+	require.True(t, ok)
+	assert.Empty(t, feature.Experiments())
+
+	_, ok = project.GetFeature("unknown")
+	assert.False(t, ok)
+}
+
+func TestProject_GetFeature_noFeatureFlags(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`{"version": "4"}`))
+	require.NoError(t, err)
+	assert.NotNil(t, project.features)
+	assert.Empty(t, project.features)
+	_, ok := project.GetFeature("checkout")
+	assert.False(t, ok)
+}
+
+func TestProject_IsFeatureEnabled(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "id": "1",
+      "key": "paused_experiment",
+      "status": "Paused",
+      "variations": [{"id": "11", "key": "on", "featureEnabled": true}],
+      "trafficAllocation": [{"entityId": "11", "endOfRange": 10000}]
+    },
+    {
+      "id": "2",
+      "key": "checkout_experiment",
+      "status": "Running",
+      "variations": [
+        {"id": "21", "key": "on", "featureEnabled": true},
+        {"id": "22", "key": "off", "featureEnabled": false},
+        {"id": "23", "key": "unset"}
+      ],
+      "trafficAllocation": [{"entityId": "21", "endOfRange": 5000}],
+      "forcedVariations": {"on_user": "on", "off_user": "off", "unset_user": "unset"}
+    }
+  ],
+  "featureFlags": [
+    {"id": "10", "key": "checkout", "experimentIds": ["1", "2"]},
+    {"id": "20", "key": "rolled_out", "experimentIds": [], "rolloutId": "30"}
+  ]
+}
+`))
+	require.NoError(t, err)
+	// the experiments of features are resolved by the project, so they are not unknown experiments
+	project.StrictExperimentKeys(func(experimentKey string) {
+		t.Errorf("unexpected unknown experiment %v", experimentKey)
+	})
+	tests := []struct {
+		name              string
+		featureKey        string
+		userID            string
+		expectedEnabled   bool
+		expectedVariation string
+	}{
+		{"enabled variation", "checkout", "on_user", true, "on"},
+		{"disabled variation", "checkout", "off_user", false, "off"},
+		{"variation without feature enabled flag", "checkout", "unset_user", false, "unset"},
+		{"bucketed user", "checkout", "user2", true, "on"},
+		{"user outside of traffic allocation", "checkout", "user3", false, ""},
+		{"feature without experiments", "rolled_out", "on_user", false, ""},
+		{"unknown feature", "unknown", "on_user", false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			enabled, impression := project.IsFeatureEnabled(test.featureKey, test.userID)
+			assert.Equal(t, test.expectedEnabled, enabled)
+			if test.expectedVariation == "" {
+				assert.Nil(t, impression)
+				return
+			}
+			require.NotNil(t, impression)
+			assert.Equal(t, test.expectedVariation, impression.Key)
+			assert.Equal(t, "checkout_experiment", impression.experiment.Key)
+			assert.Equal(t, test.userID, impression.UserID)
+		})
+	}
+}
+
+func BenchmarkProject_IsFeatureEnabled(b *testing.B) {
+	// a feature of an account with many experiments, which must not be searched for every decision
+	df := Datafile{}
+	if err := json.Unmarshal(largeDatafile(5000), &df); err != nil {
+		b.Fatal(err)
+	}
+	df.FeatureFlags = []DatafileFeatureFlag{{ID: "1", Key: "checkout", ExperimentIDs: []string{"100042"}}}
+	datafile, err := json.Marshal(df)
+	if err != nil {
+		b.Fatal(err)
+	}
+	project, err := NewProjectFromDataFile(datafile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, impression := project.IsFeatureEnabled("checkout", "qa_user"); impression == nil {
+			b.Fatal("expected an impression")
+		}
+	}
+}
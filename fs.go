@@ -0,0 +1,34 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package optimizely
+
+import (
+	"io/fs"
+
+	"golang.org/x/xerrors"
+)
+
+// NewProjectFromFS creates a new Optimizely project from the JSON datafile at the given path
+// within a filesystem, such as one embedded in the binary with go:embed.
+func NewProjectFromFS(fsys fs.FS, path string) (Project, error) {
+	datafileJSON, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return Project{}, xerrors.Errorf("error reading datafile from %s: %w", path, err)
+	}
+	return NewProjectFromDataFile(datafileJSON)
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package optimizely
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProjectFromFS(t *testing.T) {
+	datafile := []byte(`{"version": "4", "projectId": "1234", "revision": "5"}`)
+	fsys := fstest.MapFS{
+		"datafiles/production.json": &fstest.MapFile{Data: datafile},
+		"datafiles/invalid.json":    &fstest.MapFile{Data: []byte(`{"version": "3"}`)},
+	}
+	tests := []struct {
+		name        string
+		path        string
+		expectError bool
+	}{
+		{
+			"project is created from datafile in filesystem",
+			"datafiles/production.json",
+			false,
+		}, {
+			"missing datafile returns error",
+			"datafiles/staging.json",
+			true,
+		}, {
+			"invalid datafile returns error",
+			"datafiles/invalid.json",
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project, err := NewProjectFromFS(fsys, test.path)
+			if test.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			expected, err := NewProjectFromDataFile(datafile)
+			require.NoError(t, err)
+			assert.Equal(t, expected, project)
+		})
+	}
+}
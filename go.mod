@@ -1,6 +1,6 @@
 module github.com/spothero/optimizely-sdk-go
 
-go 1.12
+go 1.13
 
 require (
 	github.com/google/uuid v1.1.1
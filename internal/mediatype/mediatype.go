@@ -0,0 +1,33 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mediatype checks the content of HTTP responses that are expected to contain datafiles.
+package mediatype
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+)
+
+// IsJSON returns whether a response with the given content type and body contains JSON. Datafiles
+// are not always served with a JSON media type, e.g. when stored in S3 without metadata, so a body
+// that looks like a JSON object is also accepted.
+func IsJSON(contentType string, body []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))
+}
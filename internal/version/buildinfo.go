@@ -12,9 +12,10 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build go1.12
 // +build go1.12
 
-package optimizely
+package version
 
 import (
 	"runtime/debug"
@@ -29,8 +30,8 @@ func init() {
 		return
 	}
 	for _, dep := range buildInfo.Deps {
-		if dep.Path == packagePath {
-			clientVersion = dep.Version
+		if dep.Path == ModulePath {
+			Version = dep.Version
 			return
 		}
 	}
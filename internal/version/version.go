@@ -0,0 +1,25 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package version resolves the version of this library from the Go build info so that it can be
+// shared by the packages that report it to Optimizely.
+package version
+
+// ModulePath is the path of this module as it appears in the module dependencies of the importing
+// binary.
+const ModulePath = "github.com/spothero/optimizely-sdk-go"
+
+// Version is the version of this module in the build info of the importing binary, or empty if it
+// cannot be determined.
+var Version = ""
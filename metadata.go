@@ -0,0 +1,126 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// DatafileMeta is read-only information about the experiments in a datafile, as returned by
+// ParseDatafileMetadata.
+type DatafileMeta struct {
+	Version   string
+	Revision  string
+	ProjectID string
+	AccountID string
+	// experiments of the datafile, including experiments in groups, sorted by key; like in a Project,
+	// there is one experiment per key
+	Experiments []ExperimentMeta
+}
+
+// ExperimentMeta is read-only information about an experiment in a datafile.
+type ExperimentMeta struct {
+	ID      string
+	Key     string
+	LayerID string
+	Status  string
+	// ID of the mutually exclusive group of the experiment; empty if the experiment is not in one
+	GroupID           string
+	Variations        []DatafileVariation
+	TrafficAllocation []TrafficAllocationMeta
+}
+
+// TrafficAllocationMeta is read-only information about a range of the traffic allocation of an
+// experiment in a datafile.
+type TrafficAllocationMeta struct {
+	VariationKey string
+	EndOfRange   int
+}
+
+// ParseDatafileMetadata parses the experiments, variations, and traffic allocations of a raw JSON
+// datafile without building a Project. This is cheaper than NewProjectFromDataFile for tools that
+// inspect datafiles but never bucket users. The datafile is validated like it is by
+// NewProjectFromDataFile, so an error is returned for any datafile that a project cannot be
+// created from.
+func ParseDatafileMetadata(datafileJSON []byte) (DatafileMeta, error) {
+	df := Datafile{}
+	if err := json.Unmarshal(datafileJSON, &df); err != nil {
+		return DatafileMeta{}, err
+	}
+	if df.Version != supportedDatafileVersion {
+		return DatafileMeta{}, fmt.Errorf("could not parse unsupported datafile version %v", df.Version)
+	}
+	meta := DatafileMeta{
+		Version:   df.Version,
+		Revision:  df.Revision,
+		ProjectID: df.ProjectID,
+		AccountID: df.AccountID,
+	}
+	// like in a project, experiments are identified by key, and experiments within groups take
+	// precedence over top-level experiments with the same key
+	experiments := make(map[string]ExperimentMeta, len(df.Experiments))
+	for _, exp := range df.Experiments {
+		experiment, err := newExperimentMeta(exp, "")
+		if err != nil {
+			return DatafileMeta{}, err
+		}
+		experiments[experiment.Key] = experiment
+	}
+	for _, g := range df.Groups {
+		groupID := ""
+		if grp := newGroup(g); grp != nil {
+			groupID = grp.id
+		}
+		for _, exp := range g.Experiments {
+			experiment, err := newExperimentMeta(exp, groupID)
+			if err != nil {
+				return DatafileMeta{}, err
+			}
+			experiments[experiment.Key] = experiment
+		}
+	}
+	meta.Experiments = make([]ExperimentMeta, 0, len(experiments))
+	for _, experiment := range experiments {
+		meta.Experiments = append(meta.Experiments, experiment)
+	}
+	sort.Slice(meta.Experiments, func(i, j int) bool { return meta.Experiments[i].Key < meta.Experiments[j].Key })
+	return meta, nil
+}
+
+// newExperimentMeta converts an experiment from the datafile into its metadata.
+func newExperimentMeta(exp DatafileExperiment, groupID string) (ExperimentMeta, error) {
+	ranges, err := datafileTrafficAllocation(exp)
+	if err != nil {
+		return ExperimentMeta{}, err
+	}
+	experiment := ExperimentMeta{
+		ID:                exp.ID,
+		Key:               exp.Key,
+		LayerID:           exp.LayerID,
+		Status:            exp.Status,
+		GroupID:           groupID,
+		Variations:        append([]DatafileVariation{}, exp.Variations...),
+		TrafficAllocation: make([]TrafficAllocationMeta, 0, len(ranges)),
+	}
+	for _, r := range ranges {
+		experiment.TrafficAllocation = append(
+			experiment.TrafficAllocation,
+			TrafficAllocationMeta{VariationKey: exp.Variations[r.variation].Key, EndOfRange: r.endOfRange},
+		)
+	}
+	return experiment, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDatafileMetadata(t *testing.T) {
+	datafile := []byte(`
+{
+  "version": "4",
+  "projectId": "1234",
+  "accountId": "00001",
+  "revision": "666",
+  "experiments": [
+    {
+      "status": "Running",
+      "variations": [
+        {"id": "abc123", "key": "variation_1"},
+        {"id": "def456", "key": "variation_2"}
+      ],
+      "id": "5678",
+      "key": "an_experiment",
+      "layerId": "layer",
+      "trafficAllocation": [
+        {"entityId": "abc123", "endOfRange": 3000},
+        {"entityId": "def456", "endOfRange": 10000}
+      ],
+      "forcedVariations": {"xyz": "variation_1"}
+    }
+  ],
+  "groups": [
+    {
+      "id": "group_1",
+      "policy": "random",
+      "trafficAllocation": [{"entityId": "9012", "endOfRange": 10000}],
+      "experiments": [
+        {
+          "status": "Paused",
+          "variations": [{"id": "ghi789", "key": "variation_1"}],
+          "id": "9012",
+          "key": "grouped_experiment",
+          "layerId": "layer_2",
+          "trafficAllocation": [{"entityId": "ghi789", "endOfRange": 10000}]
+        }
+      ]
+    },
+    {
+      "id": "group_2",
+      "policy": "overlapping",
+      "trafficAllocation": [],
+      "experiments": [
+        {
+          "status": "Running",
+          "variations": [],
+          "id": "3456",
+          "key": "overlapping_experiment",
+          "layerId": "layer_3",
+          "trafficAllocation": []
+        }
+      ]
+    }
+  ]
+}
+`)
+	meta := assertMetadataMatchesProject(t, datafile)
+	require.Len(t, meta.Experiments, 3)
+	assert.Equal(t, "an_experiment", meta.Experiments[0].Key)
+	assert.Equal(t, "grouped_experiment", meta.Experiments[1].Key)
+	assert.Equal(t, "overlapping_experiment", meta.Experiments[2].Key)
+}
+
+// assertMetadataMatchesProject checks that the metadata parsed from the datafile matches a project
+// created from it and returns the metadata.
+func assertMetadataMatchesProject(t *testing.T, datafile []byte) DatafileMeta {
+	meta, err := ParseDatafileMetadata(datafile)
+	require.NoError(t, err)
+	project, err := NewProjectFromDataFile(datafile)
+	require.NoError(t, err)
+
+	assert.Equal(t, project.Version, meta.Version)
+	assert.Equal(t, project.Revision, meta.Revision)
+	assert.Equal(t, project.ProjectID, meta.ProjectID)
+	assert.Equal(t, project.AccountID, meta.AccountID)
+	require.Len(t, meta.Experiments, project.ExperimentCount())
+	for _, em := range meta.Experiments {
+		experiment, ok := project.GetExperiment(em.Key)
+		require.True(t, ok, em.Key)
+		assert.Equal(t, experiment.id, em.ID)
+		assert.Equal(t, experiment.layerID, em.LayerID)
+		assert.Equal(t, experiment.status, em.Status)
+		groupID, _ := experiment.GroupID()
+		assert.Equal(t, groupID, em.GroupID)
+		variationKeys := make([]string, 0, len(em.Variations))
+		for _, v := range em.Variations {
+			assert.Equal(t, experiment.variations[v.Key].id, v.ID)
+			variationKeys = append(variationKeys, v.Key)
+		}
+		expectedKeys := make([]string, 0, experiment.VariationCount())
+		for key := range experiment.variations {
+			expectedKeys = append(expectedKeys, key)
+		}
+		sort.Strings(variationKeys)
+		sort.Strings(expectedKeys)
+		assert.Equal(t, expectedKeys, variationKeys)
+		require.Len(t, em.TrafficAllocation, len(experiment.trafficAllocation))
+		for i, a := range experiment.trafficAllocation {
+			assert.Equal(t, TrafficAllocationMeta{VariationKey: a.Variation.Key, EndOfRange: a.endOfRange}, em.TrafficAllocation[i])
+		}
+	}
+	return meta
+}
+
+func TestParseDatafileMetadata_matchesProject(t *testing.T) {
+	tests := []struct {
+		name                      string
+		datafile                  string
+		expectedTrafficAllocation map[string][]TrafficAllocationMeta
+	}{
+		{
+			"unsorted traffic allocation",
+			`{"version": "4", "experiments": [{"id": "1", "key": "a",
+			"variations": [{"id": "v1", "key": "one"}, {"id": "v2", "key": "two"}],
+			"trafficAllocation": [{"entityId": "v2", "endOfRange": 10000}, {"entityId": "v1", "endOfRange": 4000}]}]}`,
+			map[string][]TrafficAllocationMeta{"a": {{"one", 4000}, {"two", 10000}}},
+		}, {
+			"duplicate ends of range are ordered by variation ID",
+			`{"version": "4", "experiments": [{"id": "1", "key": "a",
+			"variations": [{"id": "v1", "key": "one"}, {"id": "v2", "key": "two"}],
+			"trafficAllocation": [{"entityId": "v2", "endOfRange": 5000}, {"entityId": "v1", "endOfRange": 5000}]}]}`,
+			map[string][]TrafficAllocationMeta{"a": {{"one", 5000}, {"two", 5000}}},
+		}, {
+			"the last top-level experiment with a duplicate key is used",
+			`{"version": "4", "experiments": [
+			{"id": "1", "key": "a", "variations": [{"id": "v1", "key": "one"}], "trafficAllocation": [{"entityId": "v1", "endOfRange": 1000}]},
+			{"id": "2", "key": "a", "variations": [{"id": "v2", "key": "two"}], "trafficAllocation": [{"entityId": "v2", "endOfRange": 2000}]}]}`,
+			map[string][]TrafficAllocationMeta{"a": {{"two", 2000}}},
+		}, {
+			"grouped experiments take precedence over top-level experiments with the same key",
+			`{"version": "4", "groups": [{"id": "g", "policy": "random", "trafficAllocation": [{"entityId": "1", "endOfRange": 10000}],
+			"experiments": [{"id": "1", "key": "a", "variations": [{"id": "v1", "key": "one"}], "trafficAllocation": [{"entityId": "v1", "endOfRange": 1000}]}]}],
+			"experiments": [
+			{"id": "2", "key": "a", "variations": [{"id": "v2", "key": "two"}], "trafficAllocation": [{"entityId": "v2", "endOfRange": 2000}]},
+			{"id": "3", "key": "b", "variations": [{"id": "v3", "key": "three"}], "trafficAllocation": [{"entityId": "v3", "endOfRange": 3000}]}]}`,
+			map[string][]TrafficAllocationMeta{"a": {{"one", 1000}}, "b": {{"three", 3000}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meta := assertMetadataMatchesProject(t, []byte(test.datafile))
+			actual := make(map[string][]TrafficAllocationMeta, len(meta.Experiments))
+			for _, em := range meta.Experiments {
+				actual[em.Key] = em.TrafficAllocation
+			}
+			assert.Equal(t, test.expectedTrafficAllocation, actual)
+		})
+	}
+}
+
+func TestParseDatafileMetadata_invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		datafile string
+	}{
+		{"malformed JSON", "{"},
+		{"unsupported version", `{"version": "3"}`},
+		{"experiment without a key", `{"version": "4", "experiments": [{"id": "5678"}]}`},
+		{
+			"unknown variation in traffic allocation",
+			`{"version": "4", "experiments": [{"key": "a", "trafficAllocation": [{"entityId": "abc"}]}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseDatafileMetadata([]byte(test.datafile))
+			assert.Error(t, err)
+			// datafiles that cannot be parsed cannot be used to create a project either
+			_, err = NewProjectFromDataFile([]byte(test.datafile))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package mocks
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/spothero/optimizely-sdk-go/api"
 	"github.com/stretchr/testify/mock"
 )
@@ -10,11 +15,72 @@ type Client struct {
 	mock.Mock
 }
 
+// NewClientWithDatafile builds a Client whose GetDatafile returns the given datafile for the
+// named environment. The project and environment lookups return metadata derived from the
+// datafile's projectId, accountId, and revision; the project is named after its ID. None of the
+// configured calls are required, so AssertExpectations only fails for additional expectations
+// set up by the caller.
+func NewClientWithDatafile(environmentName string, datafile []byte) (*Client, error) {
+	var df struct {
+		ProjectID string `json:"projectId"`
+		AccountID string `json:"accountId"`
+		Revision  string `json:"revision"`
+	}
+	if err := json.Unmarshal(datafile, &df); err != nil {
+		return nil, fmt.Errorf("error unmarshaling datafile: %v", err)
+	}
+	projectID, err := strconv.Atoi(df.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid project ID %v in datafile", df.ProjectID)
+	}
+	// the account ID and revision are informational, so fall back to zero if they aren't numeric
+	accountID, _ := strconv.Atoi(df.AccountID)
+	revision, _ := strconv.Atoi(df.Revision)
+
+	project := api.Project{
+		ID:        projectID,
+		Name:      df.ProjectID,
+		AccountID: accountID,
+		Status:    "active",
+	}
+	environment := api.Environment{
+		Key:       environmentName,
+		Name:      environmentName,
+		ProjectID: projectID,
+		IsPrimary: true,
+		Datafile: api.Datafile{
+			LatestFileSize: len(datafile),
+			Revision:       revision,
+		},
+	}
+
+	c := &Client{}
+	c.On("GetDatafile", environmentName, projectID).Return(datafile, nil).Maybe()
+	c.On("GetDatafileWithLastModified", environmentName, projectID).Return(datafile, time.Time{}, nil).Maybe()
+	c.On("GetDatafileWithMeta", environmentName, projectID).Return(datafile, environment.Datafile, nil).Maybe()
+	c.On("GetEnvironmentByProjectID", environmentName, projectID).Return(environment, nil).Maybe()
+	c.On("GetEnvironmentByProjectName", environmentName, project.Name).Return(environment, nil).Maybe()
+	c.On("GetEnvironmentsByProjectID", projectID).Return([]api.Environment{environment}, nil).Maybe()
+	c.On("GetEnvironmentsByProjectName", project.Name).Return([]api.Environment{environment}, nil).Maybe()
+	c.On("GetProjects").Return([]api.Project{project}, nil).Maybe()
+	return c, nil
+}
+
 func (c *Client) GetDatafile(environmentName string, projectID int) ([]byte, error) {
 	call := c.Called(environmentName, projectID)
 	return call.Get(0).([]byte), call.Error(1)
 }
 
+func (c *Client) GetDatafileWithLastModified(environmentName string, projectID int) ([]byte, time.Time, error) {
+	call := c.Called(environmentName, projectID)
+	return call.Get(0).([]byte), call.Get(1).(time.Time), call.Error(2)
+}
+
+func (c *Client) GetDatafileWithMeta(environmentName string, projectID int) ([]byte, api.Datafile, error) {
+	call := c.Called(environmentName, projectID)
+	return call.Get(0).([]byte), call.Get(1).(api.Datafile), call.Error(2)
+}
+
 func (c *Client) GetEnvironmentByProjectID(name string, projectID int) (api.Environment, error) {
 	call := c.Called(name, projectID)
 	return call.Get(0).(api.Environment), call.Error(1)
@@ -25,21 +91,35 @@ func (c *Client) GetEnvironmentByProjectName(name, projectName string) (api.Envi
 	return call.Get(0).(api.Environment), call.Error(1)
 }
 
-func (c *Client) GetEnvironmentsByProjectID(projectID int) ([]api.Environment, error) {
-	call := c.Called(projectID)
+func (c *Client) GetEnvironmentsByProjectID(projectID int, options ...api.ListOption) ([]api.Environment, error) {
+	call := c.Called(append([]interface{}{projectID}, listOptionArgs(options)...)...)
 	return call.Get(0).([]api.Environment), call.Error(1)
 }
 
-func (c *Client) GetEnvironmentsByProjectName(projectName string) ([]api.Environment, error) {
-	call := c.Called(projectName)
+func (c *Client) GetEnvironmentsByProjectName(projectName string, options ...api.ListOption) ([]api.Environment, error) {
+	call := c.Called(append([]interface{}{projectName}, listOptionArgs(options)...)...)
 	return call.Get(0).([]api.Environment), call.Error(1)
 }
 
-func (c *Client) GetProjects() ([]api.Project, error) {
-	call := c.Called()
+func (c *Client) GetProjects(options ...api.ListOption) ([]api.Project, error) {
+	call := c.Called(listOptionArgs(options)...)
 	return call.Get(0).([]api.Project), call.Error(1)
 }
 
+// listOptionArgs returns the options of a list method as mock arguments, so that calls with options can
+// be matched with mock.Anything.
+func listOptionArgs(options []api.ListOption) []interface{} {
+	args := make([]interface{}, 0, len(options))
+	for _, option := range options {
+		args = append(args, option)
+	}
+	return args
+}
+
 func (c *Client) ReportEvents(events []byte) error {
 	return c.Called(events).Error(0)
 }
+
+func (c *Client) ReportEventsForRegion(region string, events []byte) error {
+	return c.Called(region, events).Error(0)
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mocks_test
+
+import (
+	"fmt"
+
+	optimizely "github.com/spothero/optimizely-sdk-go"
+	"github.com/spothero/optimizely-sdk-go/mocks"
+)
+
+func ExampleNewClientWithDatafile() {
+	client, err := mocks.NewClientWithDatafile(
+		"production",
+		[]byte(`{"version": "4", "projectId": "1234", "accountId": "5678", "revision": "42"}`),
+	)
+	if err != nil {
+		panic(err)
+	}
+	environment, err := client.GetEnvironmentByProjectID("production", 1234)
+	if err != nil {
+		panic(err)
+	}
+	datafile, err := optimizely.GetDatafile(client, "production", 1234)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(environment.Datafile.Revision, datafile.ProjectID, datafile.AccountID)
+	// Output: 42 1234 5678
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package projectmock provides a mock of optimizely.Bucketer. It is kept separate from the mocks
+// package because the optimizely package's own tests import mocks, so mocks cannot depend on the
+// optimizely package without creating an import cycle.
+package projectmock
+
+import (
+	"context"
+
+	optimizely "github.com/spothero/optimizely-sdk-go"
+	"github.com/stretchr/testify/mock"
+)
+
+// Bucketer mocks out the optimizely.Bucketer interface for use in testing
+type Bucketer struct {
+	mock.Mock
+}
+
+var _ optimizely.Bucketer = (*Bucketer)(nil)
+
+// GetVariation returns the *optimizely.Impression configured for the call, which may be nil.
+func (b *Bucketer) GetVariation(experimentName, userID string) *optimizely.Impression {
+	call := b.Called(experimentName, userID)
+	impression, _ := call.Get(0).(*optimizely.Impression)
+	return impression
+}
+
+// ToContext returns the context.Context configured for the call. To drive code that uses the
+// optimizely package's context helpers, such as optimizely.GetVariation, with the mock, return a
+// context created with optimizely.ContextWithBucketer.
+func (b *Bucketer) ToContext(ctx context.Context, userID string) context.Context {
+	call := b.Called(ctx, userID)
+	return call.Get(0).(context.Context)
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projectmock_test
+
+import (
+	"context"
+	"fmt"
+
+	optimizely "github.com/spothero/optimizely-sdk-go"
+	"github.com/spothero/optimizely-sdk-go/mocks/projectmock"
+	"github.com/stretchr/testify/mock"
+)
+
+// checkoutButtonColor is an example of consumer code that depends on a Bucketer
+// rather than a concrete Project.
+func checkoutButtonColor(bucketer optimizely.Bucketer, userID string) string {
+	impression := bucketer.GetVariation("checkout_button", userID)
+	if impression == nil {
+		return "blue"
+	}
+	return impression.Key
+}
+
+func ExampleBucketer() {
+	bucketer := &projectmock.Bucketer{}
+	bucketer.On("GetVariation", "checkout_button", "bucketed-user").Return(
+		&optimizely.Impression{Variation: optimizely.Variation{Key: "green"}, UserID: "bucketed-user"})
+	bucketer.On("GetVariation", "checkout_button", "excluded-user").Return(nil)
+
+	fmt.Println(checkoutButtonColor(bucketer, "bucketed-user"))
+	fmt.Println(checkoutButtonColor(bucketer, "excluded-user"))
+	// Output:
+	// green
+	// blue
+}
+
+// handleCheckout is an example of consumer code that uses the context helpers with a Bucketer.
+func handleCheckout(ctx context.Context, bucketer optimizely.Bucketer, userID string) string {
+	ctx = bucketer.ToContext(ctx, userID)
+	color := "blue"
+	if variation := optimizely.GetVariation(ctx, "checkout_button"); variation.Key != "" {
+		color = variation.Key
+	}
+	if events := optimizely.EventsFromContext(ctx); events != nil {
+		fmt.Printf("reporting %d impression(s)\n", len(events.Visitors))
+	}
+	return color
+}
+
+func ExampleBucketer_ToContext() {
+	bucketer := &projectmock.Bucketer{}
+	bucketer.On("GetVariation", "checkout_button", "bucketed-user").Return(
+		&optimizely.Impression{Variation: optimizely.Variation{Key: "green"}, UserID: "bucketed-user"})
+	bucketer.On("GetVariation", "checkout_button", "excluded-user").Return(nil)
+	for _, userID := range []string{"bucketed-user", "excluded-user"} {
+		bucketer.On("ToContext", mock.Anything, userID).Return(
+			optimizely.ContextWithBucketer(context.Background(), bucketer, userID))
+	}
+
+	fmt.Println(handleCheckout(context.Background(), bucketer, "bucketed-user"))
+	fmt.Println(handleCheckout(context.Background(), bucketer, "excluded-user"))
+	// Output:
+	// reporting 1 impression(s)
+	// green
+	// blue
+}
@@ -18,7 +18,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/spothero/optimizely-sdk-go/api"
 	"golang.org/x/xerrors"
@@ -34,8 +38,31 @@ type Project struct {
 	Revision    string
 	ProjectID   string
 	AccountID   string
+	Region      string // data residency region of the project, e.g. "EU", if set in the datafile
+	SDKKey      string // key of the environment that the datafile was generated for, if set in the datafile
 	experiments map[string]Experiment
+	// conversion events that can be tracked, by key
+	events map[string]conversionEvent
+	// feature flags, by key
+	features    map[string]Feature
 	RawDataFile json.RawMessage
+	// time at which the datafile was last modified, if known
+	lastModified time.Time
+	// keys of the experiments referenced by the caller, used in strict mode
+	knownExperiments map[string]bool
+	// invoked with unknown experiment keys in strict mode; nil when strict mode is off
+	onUnknownExperiment func(experimentKey string)
+	// invoked with experiments whose status is not a known Optimizely status, if set
+	onUnknownStatus func(experimentKey, status string)
+	// upper bound of bucket values; zero means the Optimizely value of maxTrafficValue
+	maxTraffic int
+	// composes the bucketing key of a user and an entity; nil means DefaultBucketingKey
+	bucketingKeyFunc func(bucketingID, entityID string) string
+	// namespaces appended to the IDs of experiments when bucketing, by experiment key
+	experimentNamespaces map[string]string
+	// store of bucketing decisions shared outside of the process, if any
+	decisionStore        DecisionStore
+	onDecisionStoreError func(error)
 }
 
 // Experiment represents a single Optimizely experiment. It contains metadata
@@ -45,18 +72,29 @@ type Experiment struct {
 	id                string
 	layerID           string
 	status            string
+	variations        map[string]Variation // variations by key
 	trafficAllocation []trafficAllocation
 	forcedVariations  map[string]Variation
 	mutex             *sync.RWMutex
 	cachedVariations  map[string]Variation
+	group             *group   // mutually exclusive group the experiment belongs to, if any
 	project           *Project // backref to the owning project
 }
 
+// conversionEvent is an event defined in the datafile whose conversions can be tracked.
+type conversionEvent struct {
+	id            string
+	key           string
+	experimentIDs []string
+	project       *Project // backref to the owning project
+}
+
 // Variation represents a variation of an Optimizely experiment.
 type Variation struct {
-	id         string
-	Key        string
-	experiment *Experiment // backref to the owning experiment
+	id             string
+	Key            string
+	featureEnabled bool        // whether the feature tested by the experiment is enabled in the variation
+	experiment     *Experiment // backref to the owning experiment
 }
 
 // trafficAllocation defines the value of traffic to direct to a particular experiment variation.
@@ -65,6 +103,20 @@ type trafficAllocation struct {
 	Variation  Variation
 }
 
+// group is a set of mutually exclusive experiments. Users are first bucketed into at most
+// one experiment of the group and only then bucketed into a variation of that experiment.
+type group struct {
+	id                string
+	trafficAllocation []groupAllocation
+}
+
+// groupAllocation defines the value of traffic to direct to a particular experiment within
+// a group. An empty experiment ID represents the group's holdback.
+type groupAllocation struct {
+	endOfRange   int
+	experimentID string
+}
+
 // DatafileExperiment is the structure of the experiment within a datafile. This
 // type is only used when deserializing the datafile.
 type DatafileExperiment struct {
@@ -79,8 +131,9 @@ type DatafileExperiment struct {
 
 // DatafileVariation is an experiment variation within a datafile used for deserialization.
 type DatafileVariation struct {
-	ID  string `json:"id"`
-	Key string `json:"key"`
+	ID             string `json:"id"`
+	Key            string `json:"key"`
+	FeatureEnabled *bool  `json:"featureEnabled"`
 }
 
 // DatafileTrafficAllocation is the structure of the traffic allocation with a datafile. This type
@@ -90,98 +143,462 @@ type DatafileTrafficAllocation struct {
 	EndOfRange int    `json:"endOfRange"`
 }
 
+// IncrementalTrafficAllocation is the percentage, from 0 to 100, of traffic allocated to a single
+// variation, independent of the allocations of other variations.
+type IncrementalTrafficAllocation struct {
+	EntityID   string
+	Percentage float64
+}
+
+// CumulativeTrafficAllocation converts traffic allocations expressed as incremental percentages
+// per variation, e.g. [30, 70], into the cumulative end of range values expected in a datafile,
+// e.g. [3000, 10000]. The result can be used in a DatafileExperiment that is marshaled and passed
+// to NewProjectFromDataFile. An error is returned if any percentage is negative or the percentages
+// add up to more than 100.
+func CumulativeTrafficAllocation(allocations []IncrementalTrafficAllocation) ([]DatafileTrafficAllocation, error) {
+	cumulative := make([]DatafileTrafficAllocation, 0, len(allocations))
+	total := 0.0
+	for _, a := range allocations {
+		if a.Percentage < 0 {
+			return nil, fmt.Errorf("negative traffic allocation %v for %v", a.Percentage, a.EntityID)
+		}
+		total += a.Percentage
+		// round to the nearest bucket so floating point error doesn't shift ranges by one
+		endOfRange := int(math.Round(total * maxTrafficValue / 100))
+		if endOfRange > maxTrafficValue {
+			return nil, fmt.Errorf("traffic allocations add up to more than 100%%")
+		}
+		cumulative = append(cumulative, DatafileTrafficAllocation{EntityID: a.EntityID, EndOfRange: endOfRange})
+	}
+	return cumulative, nil
+}
+
+// DatafileGroup is the structure of a group of experiments within a datafile. This type is
+// only used when deserializing the datafile.
+type DatafileGroup struct {
+	ID                string                      `json:"id"`
+	Policy            string                      `json:"policy"`
+	TrafficAllocation []DatafileTrafficAllocation `json:"trafficAllocation"`
+	Experiments       []DatafileExperiment        `json:"experiments"`
+}
+
+// DatafileEvent is the structure of a conversion event within a datafile. This type is only
+// used when deserializing the datafile.
+type DatafileEvent struct {
+	ID            string   `json:"id"`
+	Key           string   `json:"key"`
+	ExperimentIDs []string `json:"experimentIds"`
+}
+
+// DatafileFeatureFlag is the structure of a feature flag within a datafile. This type is only used
+// when deserializing the datafile.
+type DatafileFeatureFlag struct {
+	ID            string             `json:"id"`
+	Key           string             `json:"key"`
+	ExperimentIDs []string           `json:"experimentIds"`
+	RolloutID     string             `json:"rolloutId"`
+	Variables     []DatafileVariable `json:"variables"`
+}
+
+// DatafileVariable is the structure of a variable of a feature flag within a datafile. This type is
+// only used when deserializing the datafile.
+type DatafileVariable struct {
+	ID           string `json:"id"`
+	Key          string `json:"key"`
+	Type         string `json:"type"`
+	DefaultValue string `json:"defaultValue"`
+}
+
 // Datafile used for loading the JSON datafile from Optimizely
 type Datafile struct {
-	Version     string               `json:"version"`
-	Revision    string               `json:"revision"`
-	ProjectID   string               `json:"projectId"`
-	AccountID   string               `json:"accountId"`
-	Experiments []DatafileExperiment `json:"experiments"`
+	Version      string                `json:"version"`
+	Revision     string                `json:"revision"`
+	ProjectID    string                `json:"projectId"`
+	AccountID    string                `json:"accountId"`
+	Region       string                `json:"region"`
+	SDKKey       string                `json:"sdkKey"`
+	Experiments  []DatafileExperiment  `json:"experiments"`
+	Groups       []DatafileGroup       `json:"groups"`
+	Events       []DatafileEvent       `json:"events"`
+	FeatureFlags []DatafileFeatureFlag `json:"featureFlags"`
 }
 
+// policy of a group whose experiments are mutually exclusive
+const randomGroupPolicy = "random"
+
 // NewProjectFromDataFile creates a new Optimizely project given the raw JSON datafile
 func NewProjectFromDataFile(datafileJSON []byte) (Project, error) {
-	df := Datafile{}
-	if err := json.Unmarshal(datafileJSON, &df); err != nil {
+	project := Project{RawDataFile: datafileJSON}
+	df, err := decodeDatafile(datafileJSON, &project)
+	if err != nil {
 		return Project{}, err
 	}
-	if df.Version != supportedDatafileVersion {
-		return Project{}, fmt.Errorf("could not create project from unsupported datafile version %v", df.Version)
-	}
-
-	project := Project{
-		Version:     df.Version,
-		Revision:    df.Revision,
-		ProjectID:   df.ProjectID,
-		AccountID:   df.AccountID,
-		RawDataFile: datafileJSON,
-	}
-
-	// convert list of experiments in the datafile to a map of experiments for faster lookup
-	experiments := make(map[string]Experiment, len(df.Experiments))
-	for _, exp := range df.Experiments {
-		experiment := Experiment{
-			id:               exp.ID,
-			Key:              exp.Key,
-			layerID:          exp.LayerID,
-			status:           exp.Status,
-			cachedVariations: make(map[string]Variation),
-			mutex:            &sync.RWMutex{},
-			project:          &project,
+	if df.version != supportedDatafileVersion {
+		return Project{}, fmt.Errorf("could not create project from unsupported datafile version %v", df.version)
+	}
+	// experiments are only validated once the version is known to be supported
+	if df.experimentsErr != nil {
+		return Project{}, df.experimentsErr
+	}
+	if df.groupsErr != nil {
+		return Project{}, df.groupsErr
+	}
+
+	project.Version = df.version
+	project.Revision = df.revision
+	project.ProjectID = df.projectID
+	project.AccountID = df.accountID
+	project.Region = df.region
+	project.SDKKey = df.sdkKey
+	// experiments within groups are listed under the group rather than at the top level, and they
+	// take precedence over top-level experiments with the same key
+	project.experiments = df.experiments
+	if project.experiments == nil {
+		project.experiments = make(map[string]Experiment, len(df.groupExperiments))
+	}
+	for key, experiment := range df.groupExperiments {
+		project.experiments[key] = experiment
+	}
+	project.events = df.events
+	project.features = df.features
+	if project.features == nil {
+		project.features = make(map[string]Feature)
+	}
+	resolveFeatureExperiments(project.features, project.experiments)
+	return project, nil
+}
+
+// newConversionEvent converts an event from the datafile into a conversionEvent belonging to the
+// given project.
+func newConversionEvent(ev DatafileEvent, project *Project) conversionEvent {
+	experimentIDs := make([]string, len(ev.ExperimentIDs))
+	copy(experimentIDs, ev.ExperimentIDs)
+	return conversionEvent{
+		id:            ev.ID,
+		key:           ev.Key,
+		experimentIDs: experimentIDs,
+		project:       project,
+	}
+}
+
+// newGroup creates the group of experiments described in the datafile. Nil is returned for groups
+// whose experiments are not mutually exclusive, since experiments in an overlapping group are
+// bucketed independently, just like ungrouped experiments.
+func newGroup(g DatafileGroup) *group {
+	if g.Policy != randomGroupPolicy {
+		return nil
+	}
+	grp := &group{
+		id:                g.ID,
+		trafficAllocation: make([]groupAllocation, 0, len(g.TrafficAllocation)),
+	}
+	for _, a := range g.TrafficAllocation {
+		grp.trafficAllocation = append(
+			grp.trafficAllocation,
+			groupAllocation{
+				endOfRange:   a.EndOfRange,
+				experimentID: a.EntityID,
+			},
+		)
+	}
+	return grp
+}
+
+// allocatedRange is a range of the traffic allocation of an experiment in a datafile, resolved to
+// the index of its variation in the experiment's variations.
+type allocatedRange struct {
+	endOfRange int
+	variation  int
+}
+
+// datafileTrafficAllocation validates an experiment from the datafile and resolves its traffic
+// allocation to its variations, sorted by end of range. This is shared by NewProjectFromDataFile
+// and ParseDatafileMetadata so that both accept the same datafiles and agree on the allocations.
+func datafileTrafficAllocation(exp DatafileExperiment) ([]allocatedRange, error) {
+	// experiments are looked up by key, so an experiment without one can never be used and would
+	// shadow other experiments without keys
+	if exp.Key == "" {
+		return nil, fmt.Errorf("experiment with ID %v has no key", exp.ID)
+	}
+	// like looking variations up in a map by ID, the last variation with a duplicate ID wins
+	variationsByID := make(map[string]int, len(exp.Variations))
+	for i, v := range exp.Variations {
+		variationsByID[v.ID] = i
+	}
+	ranges := make([]allocatedRange, 0, len(exp.TrafficAllocation))
+	for _, a := range exp.TrafficAllocation {
+		variation, ok := variationsByID[a.EntityID]
+		if !ok {
+			return nil, fmt.Errorf("unknown variation ID %v found in traffic allocation", a.EntityID)
 		}
-		// store variations by their ID, but keep track by key for constructing the force variations map later
-		variationsByID := make(map[string]Variation, len(exp.Variations))
-		variationsByKey := make(map[string]Variation, len(exp.Variations))
-		for _, v := range exp.Variations {
-			variation := Variation{
-				id:         v.ID,
-				Key:        v.Key,
-				experiment: &experiment,
-			}
-			variationsByID[v.ID] = variation
-			variationsByKey[v.Key] = variation
+		ranges = append(ranges, allocatedRange{endOfRange: a.EndOfRange, variation: variation})
+	}
+	// findBucket searches the allocations by end of range, so they are sorted here rather than
+	// trusting the datafile's order. Ties, which only occur in malformed datafiles, are broken by
+	// variation ID so that the variation selected for the shared range, which is always the first,
+	// does not depend on the order of the datafile.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].endOfRange != ranges[j].endOfRange {
+			return ranges[i].endOfRange < ranges[j].endOfRange
 		}
+		return exp.Variations[ranges[i].variation].ID < exp.Variations[ranges[j].variation].ID
+	})
+	return ranges, nil
+}
 
-		ta := make([]trafficAllocation, 0, len(exp.TrafficAllocation))
-		for _, a := range exp.TrafficAllocation {
-			variation, ok := variationsByID[a.EntityID]
-			if !ok {
-				return Project{}, fmt.Errorf("unknown variation ID %v found in traffic allocation", a.EntityID)
-			}
-			ta = append(
-				ta,
-				trafficAllocation{
-					endOfRange: a.EndOfRange,
-					Variation:  variation,
-				},
-			)
+// newExperiment converts an experiment from the datafile into an Experiment belonging to the
+// given project and, optionally, a group.
+func newExperiment(exp DatafileExperiment, grp *group, project *Project) (Experiment, error) {
+	ranges, err := datafileTrafficAllocation(exp)
+	if err != nil {
+		return Experiment{}, err
+	}
+	experiment := Experiment{
+		id:               exp.ID,
+		Key:              exp.Key,
+		layerID:          exp.LayerID,
+		status:           exp.Status,
+		cachedVariations: make(map[string]Variation),
+		mutex:            &sync.RWMutex{},
+		group:            grp,
+		project:          project,
+	}
+	// store variations by their ID, but keep track by key for constructing the force variations map later
+	variationsByID := make(map[string]Variation, len(exp.Variations))
+	variationsByKey := make(map[string]Variation, len(exp.Variations))
+	for _, v := range exp.Variations {
+		variation := Variation{
+			id:             v.ID,
+			Key:            v.Key,
+			featureEnabled: v.FeatureEnabled != nil && *v.FeatureEnabled,
+			experiment:     &experiment,
 		}
-		experiment.trafficAllocation = ta
-
-		forcedVariations := make(map[string]Variation, len(exp.ForcedVariations))
-		for userID, variationName := range exp.ForcedVariations {
-			variation, ok := variationsByKey[variationName]
-			if !ok {
-				continue
-			}
-			forcedVariations[userID] = variation
+		variationsByID[v.ID] = variation
+		variationsByKey[v.Key] = variation
+	}
+
+	ta := make([]trafficAllocation, 0, len(ranges))
+	for _, r := range ranges {
+		ta = append(
+			ta,
+			trafficAllocation{
+				endOfRange: r.endOfRange,
+				Variation:  variationsByID[exp.Variations[r.variation].ID],
+			},
+		)
+	}
+	experiment.trafficAllocation = ta
+
+	forcedVariations := make(map[string]Variation, len(exp.ForcedVariations))
+	for userID, variationName := range exp.ForcedVariations {
+		variation, ok := variationsByKey[variationName]
+		if !ok {
+			continue
 		}
-		experiment.forcedVariations = forcedVariations
-		experiments[experiment.Key] = experiment
+		forcedVariations[userID] = variation
 	}
-	project.experiments = experiments
+	experiment.forcedVariations = forcedVariations
+	experiment.variations = variationsByKey
+	return experiment, nil
+}
 
-	return project, nil
+// GetExperiment returns the experiment with the given key and whether it exists in the project.
+func (p Project) GetExperiment(key string) (Experiment, bool) {
+	experiment, ok := p.experiments[key]
+	return experiment, ok
+}
+
+// ExperimentCount returns the number of experiments in the project, including experiments in groups.
+func (p Project) ExperimentCount() int {
+	return len(p.experiments)
+}
+
+// VariationCount returns the number of variations of the experiment.
+func (e Experiment) VariationCount() int {
+	return len(e.variations)
+}
+
+// RegisterKnownExperiments registers the keys of the experiments that the caller's code references.
+// Together with StrictExperimentKeys, this catches drift between the code and the datafile, such as
+// typos in experiment keys. Experiments must be registered before the project is used.
+func (p *Project) RegisterKnownExperiments(keys ...string) {
+	if p.knownExperiments == nil {
+		p.knownExperiments = make(map[string]bool, len(keys))
+	}
+	for _, key := range keys {
+		p.knownExperiments[key] = true
+	}
+}
+
+// StrictExperimentKeys enables strict mode, in which GetVariation invokes the given handler
+// with the key of any experiment that has not been registered with RegisterKnownExperiments and
+// returns no variation, even if the experiment exists in the datafile. The handler is typically
+// used to log the unknown key or fail a test. Strict mode must be enabled before the project is used.
+func (p *Project) StrictExperimentKeys(onUnknownExperiment func(experimentKey string)) {
+	p.onUnknownExperiment = onUnknownExperiment
+}
+
+// GroupID returns the ID of the mutually exclusive group that the experiment belongs to and whether
+// the experiment belongs to such a group. Experiments in overlapping groups are bucketed
+// independently, so they are not reported as belonging to a group.
+func (e Experiment) GroupID() (string, bool) {
+	if e.group == nil {
+		return "", false
+	}
+	return e.group.id, true
+}
+
+// GroupExperiments returns the sorted keys of the experiments in the mutually exclusive group with
+// the given ID. An empty list is returned if there is no such group.
+func (p Project) GroupExperiments(groupID string) []string {
+	keys := make([]string, 0)
+	for key, experiment := range p.experiments {
+		if id, ok := experiment.GroupID(); ok && id == groupID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// OnUnknownStatus sets a handler that GetVariation invokes with the key and status of an experiment
+// whose status is not one of the statuses known to this library, i.e. Running, Paused, Not started,
+// Archived, or Launched. Only running experiments are bucketed, so an experiment with a misspelled
+// or new status is never bucketed; the handler makes this visible, e.g. by logging the status.
+// GetVariation still returns no variation for the experiment. The handler must be set before the
+// project is used.
+func (p *Project) OnUnknownStatus(handler func(experimentKey, status string)) {
+	p.onUnknownStatus = handler
+}
+
+// SetMaxTrafficValue sets the upper bound of the bucket values that users are bucketed into, which
+// is also the end of range of a traffic allocation covering all traffic. Optimizely uses 10000, i.e.
+// basis points, which is the default. A larger value, e.g. 1000000, gives finer grained allocations
+// when the project is built from a datafile that was not generated by Optimizely. Changing the value
+// breaks parity with Optimizely and its other SDKs, and users are bucketed differently. The value
+// must be set before the project is used.
+func (p *Project) SetMaxTrafficValue(max int) {
+	p.maxTraffic = max
+}
+
+// maxBucketValue returns the upper bound of the bucket values of the project.
+func (p Project) maxBucketValue() int {
+	if p.maxTraffic > 0 {
+		return p.maxTraffic
+	}
+	return maxTrafficValue
+}
+
+// SetBucketingKey sets the function that composes the key hashed to bucket a user, identified by the
+// bucketing ID, into an entity, i.e. an experiment or a group. The default, DefaultBucketingKey, is
+// the format used by Optimizely and its other SDKs. A different format, e.g. with a delimiter, gives
+// parity with an SDK that composes keys differently, but breaks parity with Optimizely and its other
+// SDKs, so users are bucketed differently. The function must be set before the project is used.
+func (p *Project) SetBucketingKey(bucketingKey func(bucketingID, entityID string) string) {
+	p.bucketingKeyFunc = bucketingKey
+}
+
+func (p Project) bucketingKey(bucketingID, entityID string) string {
+	if p.bucketingKeyFunc != nil {
+		return p.bucketingKeyFunc(bucketingID, entityID)
+	}
+	return DefaultBucketingKey(bucketingID, entityID)
+}
+
+// SetExperimentNamespace sets a namespace that is appended to the ID of the experiment with the given
+// key when bucketing users into it. Rerunning an experiment with the same key and a new namespace
+// re-randomizes the population instead of users carrying over their assignment from the previous
+// run. By default, experiments have no namespace and users are bucketed by the experiment ID alone,
+// like in Optimizely and its other SDKs. Variations recorded by a DecisionStore still take precedence.
+// Namespaces must be set before the project is used.
+func (p *Project) SetExperimentNamespace(experimentKey, namespace string) {
+	if p.experimentNamespaces == nil {
+		p.experimentNamespaces = make(map[string]string)
+	}
+	p.experimentNamespaces[experimentKey] = namespace
+}
+
+// bucketingEntityID returns the entity ID that users are bucketed into for the experiment, which is
+// the experiment ID followed by the experiment's namespace, if any.
+func (p Project) bucketingEntityID(experiment Experiment) string {
+	return experiment.id + p.experimentNamespaces[experiment.Key]
+}
+
+// SameConfig returns whether the experiment has the same configuration as another experiment, e.g.
+// the same experiment in a project created from a newer datafile. Everything that affects
+// bucketing is compared: the ID, key, layer ID, status, variations, traffic allocation, forced
+// variations, and mutually exclusive group. Cached variations are ignored.
+func (e Experiment) SameConfig(other Experiment) bool {
+	if e.id != other.id || e.Key != other.Key || e.layerID != other.layerID || e.status != other.status {
+		return false
+	}
+	if !sameVariations(e.variations, other.variations) || !sameVariations(e.forcedVariations, other.forcedVariations) {
+		return false
+	}
+	if len(e.trafficAllocation) != len(other.trafficAllocation) {
+		return false
+	}
+	for i, a := range e.trafficAllocation {
+		b := other.trafficAllocation[i]
+		if a.endOfRange != b.endOfRange || !a.Variation.sameConfig(b.Variation) {
+			return false
+		}
+	}
+	if e.group == nil || other.group == nil {
+		return e.group == nil && other.group == nil
+	}
+	return reflect.DeepEqual(*e.group, *other.group)
+}
+
+// sameConfig returns whether the variation has the same ID and key as another variation,
+// ignoring the experiment that it belongs to.
+func (v Variation) sameConfig(other Variation) bool {
+	return v.id == other.id && v.Key == other.Key
+}
+
+// sameVariations returns whether two maps of variations have the same keys and variations.
+func sameVariations(a, b map[string]Variation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, variation := range a {
+		otherVariation, ok := b[key]
+		if !ok || !variation.sameConfig(otherVariation) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForcedVariations returns a copy of the forced variations configured for the experiment in the
+// datafile as a map of user ID to variation key. Use ForcedVariationsFromContext to also include the
+// runtime overrides of a context.
+func (e Experiment) ForcedVariations() map[string]string {
+	forcedVariations := make(map[string]string, len(e.forcedVariations))
+	for userID, variation := range e.forcedVariations {
+		forcedVariations[userID] = variation.Key
+	}
+	return forcedVariations
 }
 
 // type used to place the project within context.Context
 type ctxKey int
 
-// the value used to place the project within context.Context
-const projCtxKey ctxKey = iota
+const (
+	// the value used to place the project within context.Context
+	projCtxKey ctxKey = iota
+	// the value used to place forced variation overrides within context.Context
+	overridesCtxKey
+)
 
+// projectContext is the value placed within context.Context by ToContext. The context may be used by
+// many goroutines at once, e.g. when a request handler fans out, so impressions are only accessed
+// while holding the mutex. The mutex is never held while bucketing, which takes the mutex of the
+// experiment, so the two locks are never held at the same time and cannot deadlock.
 type projectContext struct {
 	Project
+	// decides the variations of GetVariation when set by ContextWithBucketer instead of the project
+	bucketer    Bucketer
 	userID      string
 	impressions []Impression
 	mutex       sync.Mutex
@@ -204,6 +621,71 @@ func (p Project) ToContext(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, projCtxKey, projectCtx)
 }
 
+// getVariation decides the variation of the context's user with the context's bucketer, if any, or
+// its project.
+func (c *projectContext) getVariation(experimentName string) *Impression {
+	if c.bucketer != nil {
+		return c.bucketer.GetVariation(experimentName, c.userID)
+	}
+	return c.GetVariation(experimentName, c.userID)
+}
+
+// ContextWithBucketer creates a context for a specific user ID, like Project.ToContext, in which
+// GetVariation decides variations with the given Bucketer. The impressions it returns are recorded
+// in the context and can be retrieved with EventsFromContext and ImpressionsFromContext. This allows
+// code that uses the context helpers to be tested with a mock Bucketer, e.g. by returning the
+// context from the mock's ToContext. The context has no project, so forced variations in the context
+// and IsForced do not apply, and impressions created outside of a project are reported without
+// experiment IDs.
+func ContextWithBucketer(ctx context.Context, b Bucketer, userID string) context.Context {
+	projectCtx := &projectContext{
+		bucketer:    b,
+		userID:      userID,
+		impressions: make([]Impression, 0),
+	}
+	return context.WithValue(ctx, projCtxKey, projectCtx)
+}
+
+// ProjectFromContext returns the project and user ID stored in the context by Project.ToContext, e.g.
+// for logging in middleware. The returned project is a shallow copy: reassigning its fields does not
+// affect the context, but its maps and the RawDataFile slice are shared with the project in the
+// context and must not be modified. False is returned if no project was stored in the context.
+func ProjectFromContext(ctx context.Context) (*Project, string, bool) {
+	projectCtx, ok := ctx.Value(projCtxKey).(*projectContext)
+	if !ok {
+		return nil, "", false
+	}
+	project := projectCtx.Project
+	return &project, projectCtx.userID, true
+}
+
+// Bucketer is the subset of Project used to bucket users into experiments. Code
+// that depends on a Bucketer instead of a Project can substitute a mock, such as
+// the one in the mocks/projectmock package, to control the variations it
+// receives in tests. Code that uses the context helpers, such as GetVariation
+// with a context, can be tested by returning a context created with
+// ContextWithBucketer from the mock's ToContext.
+type Bucketer interface {
+	GetVariation(experimentName, userID string) *Impression
+	ToContext(ctx context.Context, userID string) context.Context
+}
+
+var _ Bucketer = Project{}
+
+// WithForcedVariations creates a context in which GetVariation returns the given variations,
+// provided as a map of experiment key to variation key, instead of bucketing the user of the
+// project stored in the context. Overrides only apply to running experiments and overrides for
+// unknown variations are ignored. Because the overrides are scoped to the context, this is useful
+// for forcing variations in a single request, e.g. for previews and end-to-end tests, without
+// modifying the shared Project.
+func WithForcedVariations(ctx context.Context, overrides map[string]string) context.Context {
+	o := make(map[string]string, len(overrides))
+	for experimentKey, variationKey := range overrides {
+		o[experimentKey] = variationKey
+	}
+	return context.WithValue(ctx, overridesCtxKey, o)
+}
+
 // GetDatafile is a convenience wrapper around the api package's GetDatafile method that
 // unmarshals the datafile from the Optimizely API.
 func GetDatafile(client api.Client, environmentName string, projectID int) (Datafile, error) {
@@ -217,3 +699,58 @@ func GetDatafile(client api.Client, environmentName string, projectID int) (Data
 	}
 	return df, nil
 }
+
+// GetProject is a convenience wrapper around the api package's GetDatafileWithLastModified method
+// that creates a project from the datafile retrieved from the Optimizely API. The project records
+// when the datafile was last modified so that its age can be checked with DatafileAge.
+func GetProject(client api.Client, environmentName string, projectID int) (Project, error) {
+	dfBytes, lastModified, err := client.GetDatafileWithLastModified(environmentName, projectID)
+	if err != nil {
+		return Project{}, err
+	}
+	project, err := NewProjectFromDataFile(dfBytes)
+	if err != nil {
+		return Project{}, xerrors.Errorf("error creating project from datafile: %w", err)
+	}
+	project.lastModified = lastModified
+	return project, nil
+}
+
+// DatafileAge returns how long ago the datafile of the project was last modified. Zero is returned
+// if the last modified time of the datafile is unknown, e.g. when the project was not created with
+// GetProject or the datafile response did not include a Last-Modified header.
+func (p Project) DatafileAge() time.Duration {
+	if p.lastModified.IsZero() {
+		return 0
+	}
+	return time.Since(p.lastModified)
+}
+
+// Projects holds the Optimizely projects of several environments so that a single binary can
+// embed the datafiles of every environment it is deployed to and select one at runtime.
+type Projects struct {
+	projects map[string]Project
+}
+
+// NewProjects creates projects from raw JSON datafiles keyed by environment.
+func NewProjects(datafiles map[string][]byte) (Projects, error) {
+	projects := make(map[string]Project, len(datafiles))
+	for environmentKey, datafileJSON := range datafiles {
+		project, err := NewProjectFromDataFile(datafileJSON)
+		if err != nil {
+			return Projects{}, xerrors.Errorf("error loading datafile for environment %v: %w", environmentKey, err)
+		}
+		projects[environmentKey] = project
+	}
+	return Projects{projects: projects}, nil
+}
+
+// Select returns the project of the given environment. An error is returned if no datafile was
+// loaded for the environment.
+func (p Projects) Select(environmentKey string) (Project, error) {
+	project, ok := p.projects[environmentKey]
+	if !ok {
+		return Project{}, fmt.Errorf("no datafile loaded for environment %v", environmentKey)
+	}
+	return project, nil
+}
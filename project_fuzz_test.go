@@ -0,0 +1,119 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package optimizely
+
+import (
+	"testing"
+)
+
+// valid datafiles used to seed the fuzz corpus
+var fuzzSeedDatafiles = []string{
+	`{"version": "4", "projectId": "1234", "revision": "5"}`,
+	`
+{
+  "version": "4",
+  "projectId": "1234",
+  "accountId": "00001",
+  "revision": "666",
+  "experiments": [
+    {
+      "status": "Running",
+      "variations": [
+        {"id": "abc123", "key": "variation_1"},
+        {"id": "def456", "key": "variation_2"}
+      ],
+      "id": "5678",
+      "key": "an_experiment",
+      "layerId": "layer",
+      "trafficAllocation": [
+        {"entityId": "abc123", "endOfRange": 3000},
+        {"entityId": "def456", "endOfRange": 10000}
+      ],
+      "forcedVariations": {"xyz": "variation_1", "abc": "variation_2"}
+    }
+  ]
+}`,
+	`
+{
+  "version": "4",
+  "accountId": "00001",
+  "experiments": [],
+  "groups": [
+    {
+      "id": "group_1",
+      "policy": "random",
+      "trafficAllocation": [
+        {"entityId": "5678", "endOfRange": 5000},
+        {"entityId": "", "endOfRange": 10000}
+      ],
+      "experiments": [
+        {
+          "status": "Running",
+          "variations": [{"id": "abc123", "key": "variation_1"}],
+          "id": "5678",
+          "key": "grouped_experiment",
+          "layerId": "layer",
+          "trafficAllocation": [{"entityId": "abc123", "endOfRange": 10000}],
+          "forcedVariations": {}
+        }
+      ]
+    },
+    {
+      "id": "group_2",
+      "policy": "overlapping",
+      "trafficAllocation": [],
+      "experiments": [
+        {
+          "status": "Running",
+          "variations": [],
+          "id": "9012",
+          "key": "overlapping_experiment",
+          "layerId": "layer_2",
+          "trafficAllocation": [],
+          "forcedVariations": {}
+        }
+      ]
+    }
+  ]
+}`,
+}
+
+// FuzzNewProjectFromDataFile checks that arbitrary datafiles either fail to parse with an error
+// or produce a project that can bucket users without panicking, and that decoding the datafile
+// produces the same project as unmarshaling it.
+func FuzzNewProjectFromDataFile(f *testing.F) {
+	for _, datafile := range fuzzSeedDatafiles {
+		f.Add([]byte(datafile))
+	}
+	f.Fuzz(func(t *testing.T, datafile []byte) {
+		assertDecodedProjectMatchesUnmarshal(t, datafile)
+		project, err := NewProjectFromDataFile(datafile)
+		if err != nil {
+			return
+		}
+		for key, experiment := range project.experiments {
+			for _, userID := range []string{"", "abc", "xyz"} {
+				project.GetVariation(key, userID)
+			}
+			experiment.ForcedVariations()
+			if groupID, ok := experiment.GroupID(); ok {
+				project.GroupExperiments(groupID)
+			}
+		}
+	})
+}
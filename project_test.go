@@ -17,8 +17,10 @@ package optimizely
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/spothero/optimizely-sdk-go/mocks"
 	"github.com/stretchr/testify/assert"
@@ -82,6 +84,7 @@ func TestNewProjectFromDataFile(t *testing.T) {
 					ProjectID:   "1234",
 					AccountID:   "00001",
 					RawDataFile: datafile,
+					features:    map[string]Feature{},
 				}
 				exp := Experiment{
 					id:               "5678",
@@ -106,12 +109,122 @@ func TestNewProjectFromDataFile(t *testing.T) {
 					{endOfRange: 3000, Variation: var1},
 					{endOfRange: 10000, Variation: var2},
 				}
+				exp.variations = map[string]Variation{"variation_1": var1, "variation_2": var2}
 				exp.forcedVariations = map[string]Variation{"xyz": var1, "abc": var2}
 				proj.experiments = map[string]Experiment{"an_experiment": exp}
 				return proj
 			},
 			false,
 		},
+		{
+			"experiments in groups are created from datafile",
+			[]byte(`
+{
+  "version": "4",
+  "accountId": "00001",
+  "experiments": [],
+  "groups": [
+    {
+      "id": "group_1",
+      "policy": "random",
+      "trafficAllocation": [
+        {
+          "entityId": "5678",
+          "endOfRange": 5000
+        },
+        {
+          "entityId": "",
+          "endOfRange": 10000
+        }
+      ],
+      "experiments": [
+        {
+          "status": "Running",
+          "variations": [
+            {
+              "id": "abc123",
+              "key": "variation_1"
+            }
+          ],
+          "id": "5678",
+          "key": "grouped_experiment",
+          "layerId": "layer",
+          "trafficAllocation": [
+            {
+              "entityId": "abc123",
+              "endOfRange": 10000
+            }
+          ],
+          "forcedVariations": {}
+        }
+      ]
+    },
+    {
+      "id": "group_2",
+      "policy": "overlapping",
+      "trafficAllocation": [],
+      "experiments": [
+        {
+          "status": "Running",
+          "variations": [],
+          "id": "9012",
+          "key": "overlapping_experiment",
+          "layerId": "layer_2",
+          "trafficAllocation": [],
+          "forcedVariations": {}
+        }
+      ]
+    }
+  ]
+}
+`),
+			func(datafile []byte) Project {
+				proj := Project{
+					Version:     "4",
+					AccountID:   "00001",
+					RawDataFile: datafile,
+					features:    map[string]Feature{},
+				}
+				grouped := Experiment{
+					id:               "5678",
+					Key:              "grouped_experiment",
+					layerID:          "layer",
+					status:           "Running",
+					forcedVariations: map[string]Variation{},
+					cachedVariations: map[string]Variation{},
+					mutex:            &sync.RWMutex{},
+					group: &group{
+						id: "group_1",
+						trafficAllocation: []groupAllocation{
+							{endOfRange: 5000, experimentID: "5678"},
+							{endOfRange: 10000, experimentID: ""},
+						},
+					},
+					project: &proj,
+				}
+				groupedVariation := Variation{id: "abc123", Key: "variation_1", experiment: &grouped}
+				grouped.variations = map[string]Variation{"variation_1": groupedVariation}
+				grouped.trafficAllocation = []trafficAllocation{{endOfRange: 10000, Variation: groupedVariation}}
+				overlapping := Experiment{
+					id:                "9012",
+					Key:               "overlapping_experiment",
+					layerID:           "layer_2",
+					status:            "Running",
+					variations:        map[string]Variation{},
+					trafficAllocation: []trafficAllocation{},
+					forcedVariations:  map[string]Variation{},
+					cachedVariations:  map[string]Variation{},
+					mutex:             &sync.RWMutex{},
+					project:           &proj,
+				}
+				proj.experiments = map[string]Experiment{
+					"grouped_experiment":     grouped,
+					"overlapping_experiment": overlapping,
+				}
+				return proj
+			},
+			false,
+		},
 		{
 			"error on unsupported datafile version",
 			[]byte(`{"version": "3"}`),
@@ -124,6 +237,7 @@ func TestNewProjectFromDataFile(t *testing.T) {
   "version": "4",
   "experiments": [
     {
+      "key": "an_experiment",
       "variations": [
         {
           "id": "abc123",
@@ -142,18 +256,40 @@ func TestNewProjectFromDataFile(t *testing.T) {
 				proj := Project{
 					Version:     "4",
 					RawDataFile: datafile,
+					features:    map[string]Feature{},
 				}
 				exp := Experiment{
+					Key:               "an_experiment",
 					forcedVariations:  map[string]Variation{},
 					trafficAllocation: []trafficAllocation{},
 					cachedVariations:  map[string]Variation{},
 					mutex:             &sync.RWMutex{},
 					project:           &proj,
 				}
-				proj.experiments = map[string]Experiment{"": exp}
+				exp.variations = map[string]Variation{
+					"variation_1": {id: "abc123", Key: "variation_1", experiment: &exp},
+				}
+				proj.experiments = map[string]Experiment{"an_experiment": exp}
 				return proj
 			},
 			false,
+		}, {
+			"experiment without a key returns error",
+			[]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "id": "5678",
+      "key": "",
+      "variations": [],
+      "trafficAllocation": []
+    }
+  ]
+}
+`),
+			func(_ []byte) Project { return Project{} },
+			true,
 		}, {
 			"malformed JSON results in an error",
 			[]byte("{"),
@@ -200,6 +336,278 @@ func TestNewProjectFromDataFile(t *testing.T) {
 	}
 }
 
+func TestCumulativeTrafficAllocation(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations []IncrementalTrafficAllocation
+		expected    []DatafileTrafficAllocation
+		expectError bool
+	}{
+		{
+			"incremental percentages are converted to cumulative ranges",
+			[]IncrementalTrafficAllocation{{"a", 30}, {"b", 70}},
+			[]DatafileTrafficAllocation{{"a", 3000}, {"b", 10000}},
+			false,
+		}, {
+			"fractional percentages are rounded to the nearest bucket",
+			[]IncrementalTrafficAllocation{{"a", 33.33}, {"b", 33.33}, {"c", 33.34}},
+			[]DatafileTrafficAllocation{{"a", 3333}, {"b", 6666}, {"c", 10000}},
+			false,
+		}, {
+			"partial allocation leaves the remaining traffic unallocated",
+			[]IncrementalTrafficAllocation{{"a", 10}, {"b", 10}},
+			[]DatafileTrafficAllocation{{"a", 1000}, {"b", 2000}},
+			false,
+		}, {
+			"negative percentage returns error",
+			[]IncrementalTrafficAllocation{{"a", -10}, {"b", 70}},
+			nil,
+			true,
+		}, {
+			"percentages over 100 return error",
+			[]IncrementalTrafficAllocation{{"a", 50}, {"b", 70}},
+			nil,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cumulative, err := CumulativeTrafficAllocation(test.allocations)
+			if test.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, cumulative)
+		})
+	}
+}
+
+func TestNewExperiment_trafficAllocationOrder(t *testing.T) {
+	variations := []DatafileVariation{{ID: "a", Key: "a"}, {ID: "b", Key: "b"}, {ID: "c", Key: "c"}}
+	tests := []struct {
+		name       string
+		allocation []DatafileTrafficAllocation
+	}{
+		{
+			"sorted",
+			[]DatafileTrafficAllocation{{EntityID: "a", EndOfRange: 5000}, {EntityID: "b", EndOfRange: 5000}, {EntityID: "c", EndOfRange: 10000}},
+		}, {
+			"duplicate end of range in reverse order",
+			[]DatafileTrafficAllocation{{EntityID: "b", EndOfRange: 5000}, {EntityID: "a", EndOfRange: 5000}, {EntityID: "c", EndOfRange: 10000}},
+		}, {
+			"unsorted",
+			[]DatafileTrafficAllocation{{EntityID: "c", EndOfRange: 10000}, {EntityID: "b", EndOfRange: 5000}, {EntityID: "a", EndOfRange: 5000}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			experiment, err := newExperiment(
+				DatafileExperiment{ID: "1", Key: "exp", Variations: variations, TrafficAllocation: test.allocation},
+				nil,
+				&Project{},
+			)
+			require.NoError(t, err)
+			// the variation with the lowest ID wins the shared range
+			assert.Equal(t, "a", experiment.findBucket(0).Key)
+			assert.Equal(t, "a", experiment.findBucket(4999).Key)
+			assert.Equal(t, "c", experiment.findBucket(5000).Key)
+			assert.Equal(t, "c", experiment.findBucket(9999).Key)
+		})
+	}
+}
+
+func TestProject_GetExperiment(t *testing.T) {
+	p := Project{experiments: map[string]Experiment{"a": {Key: "a"}}}
+	experiment, ok := p.GetExperiment("a")
+	assert.True(t, ok)
+	assert.Equal(t, Experiment{Key: "a"}, experiment)
+	_, ok = p.GetExperiment("b")
+	assert.False(t, ok)
+}
+
+func TestProject_ExperimentCount(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "key": "an_experiment",
+      "variations": [
+        {"id": "abc123", "key": "variation_1"},
+        {"id": "def456", "key": "variation_2"}
+      ],
+      "trafficAllocation": []
+    },
+    {
+      "key": "another_experiment",
+      "variations": [],
+      "trafficAllocation": []
+    }
+  ],
+  "groups": [
+    {
+      "id": "group_1",
+      "policy": "random",
+      "trafficAllocation": [],
+      "experiments": [
+        {
+          "key": "grouped_experiment",
+          "variations": [{"id": "ghi789", "key": "variation_1"}],
+          "trafficAllocation": []
+        }
+      ]
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, project.ExperimentCount())
+	for key, expectedCount := range map[string]int{"an_experiment": 2, "another_experiment": 0, "grouped_experiment": 1} {
+		experiment, ok := project.GetExperiment(key)
+		require.True(t, ok)
+		assert.Equal(t, expectedCount, experiment.VariationCount(), key)
+	}
+	assert.Equal(t, 0, Project{}.ExperimentCount())
+}
+
+func TestExperiment_GroupID(t *testing.T) {
+	grp := &group{id: "group_1"}
+	p := Project{experiments: map[string]Experiment{
+		"b":         {Key: "b", group: grp},
+		"a":         {Key: "a", group: grp},
+		"other":     {Key: "other", group: &group{id: "group_2"}},
+		"ungrouped": {Key: "ungrouped"},
+	}}
+	groupID, ok := p.experiments["a"].GroupID()
+	assert.True(t, ok)
+	assert.Equal(t, "group_1", groupID)
+	_, ok = p.experiments["ungrouped"].GroupID()
+	assert.False(t, ok)
+	assert.Equal(t, []string{"a", "b"}, p.GroupExperiments("group_1"))
+	assert.Equal(t, []string{}, p.GroupExperiments("group_3"))
+}
+
+func TestExperiment_ForcedVariations(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "key": "an_experiment",
+      "variations": [
+        {
+          "id": "abc123",
+          "key": "variation_1"
+        }
+      ],
+      "trafficAllocation": [],
+      "forcedVariations": {
+        "xyz": "variation_1"
+      }
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	experiment, ok := project.GetExperiment("an_experiment")
+	require.True(t, ok)
+	forcedVariations := experiment.ForcedVariations()
+	assert.Equal(t, map[string]string{"xyz": "variation_1"}, forcedVariations)
+	// the returned map is a copy
+	forcedVariations["abc"] = "variation_1"
+	assert.Len(t, experiment.ForcedVariations(), 1)
+}
+
+func TestExperiment_SameConfig(t *testing.T) {
+	const datafile = `
+{
+  "version": "4",
+  "experiments": [
+    {
+      "status": "Running",
+      "id": "5678",
+      "key": "an_experiment",
+      "layerId": "layer",
+      "variations": [
+        {"id": "abc123", "key": "variation_1"},
+        {"id": "def456", "key": "variation_2"}
+      ],
+      "trafficAllocation": [
+        {"entityId": "abc123", "endOfRange": 3000},
+        {"entityId": "def456", "endOfRange": 10000}
+      ],
+      "forcedVariations": {"xyz": "variation_1"}
+    }
+  ]
+}
+`
+	getExperiment := func(t *testing.T, datafile string) Experiment {
+		project, err := NewProjectFromDataFile([]byte(datafile))
+		require.NoError(t, err)
+		experiment, ok := project.GetExperiment("an_experiment")
+		require.True(t, ok)
+		return experiment
+	}
+	experiment := getExperiment(t, datafile)
+	// variations cached by the original experiment are ignored
+	experiment.cachedVariations["user"] = experiment.variations["variation_1"]
+	tests := []struct {
+		name         string
+		old, new     string
+		expectedSame bool
+	}{
+		{"reloaded experiment has the same config", "", "", true},
+		{"different status", `"Running"`, `"Paused"`, false},
+		{"different layer", `"layer"`, `"layer_2"`, false},
+		{"different variation key", `"key": "variation_2"`, `"key": "variation_3"`, false},
+		{"different traffic allocation", `"endOfRange": 3000`, `"endOfRange": 5000`, false},
+		{"different forced variation", `{"xyz": "variation_1"}`, `{"xyz": "variation_2"}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			other := getExperiment(t, strings.Replace(datafile, test.old, test.new, 1))
+			assert.Equal(t, test.expectedSame, experiment.SameConfig(other))
+			assert.Equal(t, test.expectedSame, other.SameConfig(experiment))
+		})
+	}
+	t.Run("different group", func(t *testing.T) {
+		other := getExperiment(t, datafile)
+		other.group = &group{id: "group_1"}
+		assert.False(t, experiment.SameConfig(other))
+		experiment.group = &group{id: "group_1"}
+		assert.True(t, experiment.SameConfig(other))
+	})
+}
+
+// staticBucketer is a Bucketer that returns the same variation to every user.
+type staticBucketer struct {
+	variation string
+}
+
+func (b staticBucketer) GetVariation(_, userID string) *Impression {
+	return &Impression{Variation: Variation{Key: b.variation}, UserID: userID}
+}
+
+func (b staticBucketer) ToContext(ctx context.Context, userID string) context.Context {
+	return ContextWithBucketer(ctx, b, userID)
+}
+
+func TestContextWithBucketer(t *testing.T) {
+	ctx := staticBucketer{variation: "green"}.ToContext(context.Background(), "user")
+	assert.Equal(t, "green", GetVariation(ctx, "checkout_button").Key)
+	_, forced := IsForced(ctx, "checkout_button")
+	assert.False(t, forced)
+	require.Len(t, ImpressionsFromContext(ctx), 1)
+
+	// impressions created outside of a project are reported without experiment IDs
+	events := EventsFromContext(ctx)
+	require.NotNil(t, events)
+	require.Len(t, events.Visitors, 1)
+	assert.Equal(t, "user", events.Visitors[0].ID)
+	assert.Equal(t, []decision{{}}, events.Visitors[0].Snapshots[0].Decisions)
+}
+
 func TestProject_ToContext(t *testing.T) {
 	p := Project{ProjectID: "id"}
 	ctx := p.ToContext(context.Background(), "user")
@@ -216,6 +624,19 @@ func TestProject_ToContext(t *testing.T) {
 	)
 }
 
+func TestProjectFromContext(t *testing.T) {
+	p := Project{ProjectID: "id"}
+	project, userID, ok := ProjectFromContext(p.ToContext(context.Background(), "user"))
+	require.True(t, ok)
+	assert.Equal(t, &p, project)
+	assert.Equal(t, "user", userID)
+
+	project, userID, ok = ProjectFromContext(context.Background())
+	assert.False(t, ok)
+	assert.Nil(t, project)
+	assert.Equal(t, "", userID)
+}
+
 func TestGetDatafile(t *testing.T) {
 	const (
 		environment = "production"
@@ -263,3 +684,101 @@ func TestGetDatafile(t *testing.T) {
 		})
 	}
 }
+
+func TestGetProject(t *testing.T) {
+	const (
+		environment = "production"
+		projectID   = 1234
+	)
+	lastModified := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name          string
+		datafileBytes []byte
+		lastModified  time.Time
+		datafileErr   error
+		expectedAge   time.Duration
+		expectErr     bool
+	}{
+		{
+			"project age is computed from the datafile last modified time",
+			[]byte(`{"version": "4"}`),
+			lastModified,
+			nil,
+			time.Hour,
+			false,
+		}, {
+			"unknown last modified time results in zero age",
+			[]byte(`{"version": "4"}`),
+			time.Time{},
+			nil,
+			0,
+			false,
+		}, {
+			"error retrieving datafile from API returns error",
+			[]byte{},
+			time.Time{},
+			fmt.Errorf("api error"),
+			0,
+			true,
+		}, {
+			"error creating project returns error",
+			[]byte(`{"version": "3"}`),
+			time.Time{},
+			nil,
+			0,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &mocks.Client{}
+			client.On("GetDatafileWithLastModified", environment, projectID).
+				Return(test.datafileBytes, test.lastModified, test.datafileErr).Once()
+			defer client.AssertExpectations(t)
+			project, err := GetProject(client, environment, projectID)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.InDelta(t, test.expectedAge, project.DatafileAge(), float64(time.Minute))
+		})
+	}
+}
+
+func TestProjects_Select(t *testing.T) {
+	projects, err := NewProjects(map[string][]byte{
+		"staging":    []byte(`{"version": "4", "revision": "1"}`),
+		"production": []byte(`{"version": "4", "revision": "2"}`),
+	})
+	require.NoError(t, err)
+	tests := []struct {
+		name             string
+		environmentKey   string
+		expectedRevision string
+		expectErr        bool
+	}{
+		{"staging project is selected", "staging", "1", false},
+		{"production project is selected", "production", "2", false},
+		{"unknown environment returns error", "development", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project, err := projects.Select(test.environmentKey)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedRevision, project.Revision)
+		})
+	}
+}
+
+func TestNewProjects_invalidDatafile(t *testing.T) {
+	_, err := NewProjects(map[string][]byte{
+		"staging":    []byte(`{"version": "4"}`),
+		"production": []byte(`{"version": "3"}`),
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spothero/optimizely-sdk-go/api"
+	"golang.org/x/xerrors"
+)
+
+// ErrReporterQueueFull is returned by Reporter.Report when the reporter is configured to drop
+// events and its queue is full.
+var ErrReporterQueueFull = xerrors.New("reporter queue is full")
+
+// ErrReporterClosed is returned by Reporter.Report when the reporter has been closed.
+var ErrReporterClosed = xerrors.New("reporter is closed")
+
+// Reporter reports events to the Optimizely API in the background using a pool of workers so
+// that producing events does not block on the events API. Events are queued until a worker is
+// available. When the queue is full, Report either blocks until there is room in the queue or
+// drops the events, depending on the DropWhenFull option.
+type Reporter struct {
+	client       api.Client
+	workers      int
+	queueSize    int
+	dropWhenFull bool
+	onError      func(error)
+	queue        chan Events
+	dropped      uint64
+	closed       bool
+	// closed when the reporter is closed to stop reports that are blocked on a full queue
+	closing chan struct{}
+	// reports that may still send to the queue, which is only closed once they are done
+	senders sync.WaitGroup
+	mutex   sync.RWMutex
+	wg      sync.WaitGroup
+}
+
+// NewReporter creates a Reporter that reports events with the given client and starts its workers.
+// By default, the reporter has 4 workers, queues up to 100 events, and blocks when the queue is full.
+func NewReporter(client api.Client, options ...func(*Reporter)) *Reporter {
+	r := &Reporter{
+		client:    client,
+		workers:   4,
+		queueSize: 100,
+		closing:   make(chan struct{}),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	// without a worker, queued events would never be reported
+	if r.workers < 1 {
+		r.workers = 1
+	}
+	if r.queueSize < 0 {
+		r.queueSize = 0
+	}
+	r.queue = make(chan Events, r.queueSize)
+	r.wg.Add(r.workers)
+	for i := 0; i < r.workers; i++ {
+		go r.work()
+	}
+	return r
+}
+
+// Workers sets the number of events that a Reporter sends to the Optimizely API concurrently.
+// A Reporter always has at least one worker.
+func Workers(workers int) func(*Reporter) {
+	return func(r *Reporter) {
+		r.workers = workers
+	}
+}
+
+// QueueSize sets the number of events that a Reporter queues while all of its workers are busy.
+// With a size of zero, or a negative size, events are only accepted when a worker is available.
+func QueueSize(size int) func(*Reporter) {
+	return func(r *Reporter) {
+		r.queueSize = size
+	}
+}
+
+// DropWhenFull sets whether a Reporter drops events when its queue is full instead of blocking
+// until there is room in the queue. The number of dropped events is available from Reporter.Dropped.
+func DropWhenFull(drop bool) func(*Reporter) {
+	return func(r *Reporter) {
+		r.dropWhenFull = drop
+	}
+}
+
+// OnReportError sets a callback that a Reporter invokes, from one of its workers, with every error
+// that occurs while reporting events.
+func OnReportError(callback func(error)) func(*Reporter) {
+	return func(r *Reporter) {
+		r.onError = callback
+	}
+}
+
+// Report queues events to be reported by one of the reporter's workers. ErrReporterQueueFull
+// is returned if the events were dropped and ErrReporterClosed is returned if the reporter
+// has been closed, including while Report was blocked on a full queue.
+func (r *Reporter) Report(events Events) error {
+	r.mutex.RLock()
+	if r.closed {
+		r.mutex.RUnlock()
+		return ErrReporterClosed
+	}
+	r.senders.Add(1)
+	r.mutex.RUnlock()
+	defer r.senders.Done()
+	// the send is made without holding the lock so that blocking on a full queue does not delay Close
+	if !r.dropWhenFull {
+		select {
+		case r.queue <- events:
+			return nil
+		case <-r.closing:
+			return ErrReporterClosed
+		}
+	}
+	select {
+	case r.queue <- events:
+		return nil
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+		return ErrReporterQueueFull
+	}
+}
+
+// Dropped returns the number of events that have been dropped because the queue was full.
+func (r *Reporter) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Close stops the reporter from accepting new events and waits until all queued events have
+// been reported. Close is safe to call more than once and from multiple goroutines, such as a
+// signal handler; every call waits until the queue has been drained.
+func (r *Reporter) Close() {
+	r.mutex.Lock()
+	first := !r.closed
+	if first {
+		r.closed = true
+		close(r.closing)
+	}
+	r.mutex.Unlock()
+	if first {
+		// reports that were blocked on a full queue return once closing is closed, after which
+		// nothing sends to the queue
+		r.senders.Wait()
+		close(r.queue)
+	}
+	r.wg.Wait()
+}
+
+// CloseContext is like Close but stops waiting for queued events to be reported once ctx is done,
+// returning ctx.Err() if any events may not have been reported. This is intended for flushing
+// events during a graceful shutdown, e.g. after receiving SIGTERM, where ctx carries the
+// grace period remaining before the process is killed. Events still in flight when ctx is done
+// continue to be reported in the background.
+func (r *Reporter) CloseContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work reports events from the queue until the queue is closed.
+func (r *Reporter) work() {
+	defer r.wg.Done()
+	for events := range r.queue {
+		if err := ReportEvents(r.client, events); err != nil && r.onError != nil {
+			r.onError(err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spothero/optimizely-sdk-go/api"
+	"github.com/spothero/optimizely-sdk-go/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// creates a client whose ReportEvents signals on started and then blocks until release is closed
+func blockingClient(started chan<- struct{}, release <-chan struct{}) *mocks.Client {
+	client := &mocks.Client{}
+	client.On("ReportEvents", mock.Anything).Run(func(_ mock.Arguments) {
+		started <- struct{}{}
+		<-release
+	}).Return(nil)
+	return client
+}
+
+func TestReporter_Report(t *testing.T) {
+	tests := []struct {
+		name         string
+		dropWhenFull bool
+	}{
+		{"full queue drops events", true},
+		{"full queue blocks until there is room", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			started := make(chan struct{}, 3)
+			release := make(chan struct{})
+			client := blockingClient(started, release)
+			r := NewReporter(client, Workers(1), QueueSize(1), DropWhenFull(test.dropWhenFull))
+
+			// the first events occupy the only worker and the second fill the queue
+			require.NoError(t, r.Report(Events{AccountID: "1"}))
+			<-started
+			require.NoError(t, r.Report(Events{AccountID: "2"}))
+
+			reported := make(chan error)
+			go func() { reported <- r.Report(Events{AccountID: "3"}) }()
+			if test.dropWhenFull {
+				assert.Equal(t, ErrReporterQueueFull, <-reported)
+				assert.Equal(t, uint64(1), r.Dropped())
+				close(release)
+				r.Close()
+				client.AssertNumberOfCalls(t, "ReportEvents", 2)
+				return
+			}
+			select {
+			case <-reported:
+				assert.Fail(t, "report did not block on a full queue")
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(release)
+			assert.NoError(t, <-reported)
+			r.Close()
+			assert.Equal(t, uint64(0), r.Dropped())
+			client.AssertNumberOfCalls(t, "ReportEvents", 3)
+		})
+	}
+}
+
+func TestReporter_Close(t *testing.T) {
+	client := &mocks.Client{}
+	client.On("ReportEvents", mock.Anything).Return(fmt.Errorf("api error"))
+	var mutex sync.Mutex
+	errs := make([]error, 0)
+	r := NewReporter(client, Workers(2), OnReportError(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		errs = append(errs, err)
+	}))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, r.Report(Events{}))
+	}
+	r.Close()
+	client.AssertNumberOfCalls(t, "ReportEvents", 5)
+	assert.Len(t, errs, 5)
+	assert.Equal(t, ErrReporterClosed, r.Report(Events{}))
+	// closing more than once is safe
+	r.Close()
+}
+
+func TestNewReporter_invalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []func(*Reporter)
+	}{
+		{"negative workers", []func(*Reporter){Workers(-1)}},
+		{"no workers", []func(*Reporter){Workers(0), QueueSize(1)}},
+		{"negative queue size", []func(*Reporter){QueueSize(-1)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &mocks.Client{}
+			client.On("ReportEvents", mock.Anything).Return(nil)
+			var r *Reporter
+			require.NotPanics(t, func() { r = NewReporter(client, test.options...) })
+			for i := 0; i < 3; i++ {
+				require.NoError(t, r.Report(Events{}))
+			}
+			r.Close()
+			client.AssertNumberOfCalls(t, "ReportEvents", 3)
+		})
+	}
+}
+
+func TestReporter_CloseWhileReportIsBlocked(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	client := blockingClient(started, release)
+	r := NewReporter(client, Workers(1), QueueSize(1))
+
+	// the first events occupy the only worker, the second fill the queue, and the third block
+	require.NoError(t, r.Report(Events{AccountID: "1"}))
+	<-started
+	require.NoError(t, r.Report(Events{AccountID: "2"}))
+	blocked := make(chan error)
+	go func() { blocked <- r.Report(Events{AccountID: "3"}) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	closed := make(chan error)
+	go func() { closed <- r.CloseContext(ctx) }()
+
+	// closing stops blocked reports and rejects new ones without waiting for the queue
+	for _, reported := range []chan error{blocked, reportAsync(r)} {
+		select {
+		case err := <-reported:
+			assert.Equal(t, ErrReporterClosed, err)
+		case <-time.After(time.Second):
+			assert.Fail(t, "report blocked while the reporter was closing")
+		}
+	}
+	assert.Equal(t, context.DeadlineExceeded, <-closed)
+	close(release)
+	r.Close()
+	client.AssertNumberOfCalls(t, "ReportEvents", 2)
+}
+
+// reportAsync reports empty events in the background, sending the result on the returned channel.
+func reportAsync(r *Reporter) chan error {
+	reported := make(chan error, 1)
+	go func() { reported <- r.Report(Events{}) }()
+	return reported
+}
+
+func TestReporter_CloseContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		blocking    bool
+		expectedErr error
+	}{
+		{"pending events are flushed within the deadline", false, nil},
+		{"deadline exceeded before events are flushed", true, context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			started := make(chan struct{}, 3)
+			release := make(chan struct{})
+			if !test.blocking {
+				close(release)
+			}
+			client := blockingClient(started, release)
+			r := NewReporter(client, Workers(1))
+			for i := 0; i < 3; i++ {
+				require.NoError(t, r.Report(Events{}))
+			}
+
+			// simulate a shutdown with a grace period
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			assert.Equal(t, test.expectedErr, r.CloseContext(ctx))
+			assert.Equal(t, ErrReporterClosed, r.Report(Events{}))
+			if test.blocking {
+				close(release)
+				r.Close()
+			}
+			client.AssertNumberOfCalls(t, "ReportEvents", 3)
+		})
+	}
+}
+
+func ExampleReporter_CloseContext() {
+	client := api.NewClient(api.Token("api-token"))
+	reporter := NewReporter(client)
+
+	// flush events when the process is asked to shut down, e.g. during a rolling restart
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	<-signals
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := reporter.CloseContext(ctx); err != nil {
+		fmt.Println("not all events were reported before shutdown:", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// maximum number of decimal places of the percentages returned by TrafficSplit
+const maxSplitDecimals = 6
+
+// TrafficSplit returns the percentage of traffic allocated to each variation of the experiment with
+// the given key, by variation key, rounded to the given number of decimal places, e.g. 0 for whole
+// percentages. The percentages are rounded with the largest remainder method so that they add up to
+// the rounded total allocation of the experiment, i.e. 100 for a fully allocated experiment, rather
+// than being off by one due to rounding each percentage independently. Ties are broken by variation
+// key. An error is returned if the experiment does not exist or decimals is not between 0 and 6.
+func (p Project) TrafficSplit(experimentKey string, decimals int) (map[string]float64, error) {
+	experiment, ok := p.experiments[experimentKey]
+	if !ok {
+		return nil, fmt.Errorf("experiment %v not found", experimentKey)
+	}
+	if decimals < 0 || decimals > maxSplitDecimals {
+		return nil, fmt.Errorf("traffic split precision must be between 0 and %d decimals, got %d", maxSplitDecimals, decimals)
+	}
+	// sum the buckets of each variation, which may have more than one range
+	max := p.maxBucketValue()
+	buckets := make(map[string]int, len(experiment.variations))
+	start := 0
+	for _, allocation := range experiment.trafficAllocation {
+		end := allocation.endOfRange
+		if end > max {
+			end = max
+		}
+		if end > start {
+			buckets[allocation.Variation.Key] += end - start
+			start = end
+		}
+	}
+
+	// work in units of the requested precision, e.g. tenths of a percent for one decimal place
+	scale := math.Pow10(decimals)
+	type share struct {
+		key       string
+		units     float64
+		remainder float64
+	}
+	shares := make([]share, 0, len(buckets))
+	exactTotal, flooredTotal := 0.0, 0.0
+	for key, b := range buckets {
+		exact := float64(b) * 100 * scale / float64(max)
+		floored := math.Floor(exact)
+		shares = append(shares, share{key: key, units: floored, remainder: exact - floored})
+		exactTotal += exact
+		flooredTotal += floored
+	}
+	// hand out the units lost to flooring to the shares with the largest remainders
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].remainder != shares[j].remainder {
+			return shares[i].remainder > shares[j].remainder
+		}
+		return shares[i].key < shares[j].key
+	})
+	missing := int(math.Round(exactTotal) - flooredTotal)
+	for i := 0; i < missing && i < len(shares); i++ {
+		shares[i].units++
+	}
+
+	split := make(map[string]float64, len(shares))
+	for _, s := range shares {
+		split[s.key] = s.units / scale
+	}
+	return split, nil
+}
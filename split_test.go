@@ -0,0 +1,100 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProject_TrafficSplit(t *testing.T) {
+	thirds := []trafficAllocation{
+		{endOfRange: 3333, Variation: Variation{id: "a", Key: "a"}},
+		{endOfRange: 6666, Variation: Variation{id: "b", Key: "b"}},
+		{endOfRange: 10000, Variation: Variation{id: "c", Key: "c"}},
+	}
+	tests := []struct {
+		name          string
+		allocation    []trafficAllocation
+		maxTraffic    int
+		decimals      int
+		expected      map[string]float64
+		expectedTotal float64
+	}{
+		{"thirds in whole percent", thirds, 0, 0, map[string]float64{"a": 33, "b": 33, "c": 34}, 100},
+		{"thirds with one decimal", thirds, 0, 1, map[string]float64{"a": 33.3, "b": 33.3, "c": 33.4}, 100},
+		{
+			"exact thirds break ties by variation key",
+			[]trafficAllocation{
+				{endOfRange: 1, Variation: Variation{id: "a", Key: "a"}},
+				{endOfRange: 2, Variation: Variation{id: "b", Key: "b"}},
+				{endOfRange: 3, Variation: Variation{id: "c", Key: "c"}},
+			},
+			3,
+			0,
+			map[string]float64{"a": 34, "b": 33, "c": 33},
+			100,
+		}, {
+			"partial allocation adds up to the allocated traffic",
+			[]trafficAllocation{
+				{endOfRange: 2505, Variation: Variation{id: "a", Key: "a"}},
+				{endOfRange: 5000, Variation: Variation{id: "b", Key: "b"}},
+			},
+			0,
+			0,
+			map[string]float64{"a": 25, "b": 25},
+			50,
+		}, {
+			"variation with several ranges",
+			[]trafficAllocation{
+				{endOfRange: 2000, Variation: Variation{id: "a", Key: "a"}},
+				{endOfRange: 7000, Variation: Variation{id: "b", Key: "b"}},
+				{endOfRange: 10000, Variation: Variation{id: "a", Key: "a"}},
+			},
+			0,
+			0,
+			map[string]float64{"a": 50, "b": 50},
+			100,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Project{
+				experiments: map[string]Experiment{"exp": {trafficAllocation: test.allocation}},
+				maxTraffic:  test.maxTraffic,
+			}
+			split, err := p.TrafficSplit("exp", test.decimals)
+			require.NoError(t, err)
+			assert.InDeltaMapValues(t, test.expected, split, 1e-9)
+			total := 0.0
+			for _, percentage := range split {
+				total += percentage
+			}
+			assert.InDelta(t, test.expectedTotal, total, 1e-9)
+		})
+	}
+}
+
+func TestProject_TrafficSplit_errors(t *testing.T) {
+	p := Project{experiments: map[string]Experiment{"exp": {}}}
+	_, err := p.TrafficSplit("missing", 0)
+	assert.Error(t, err)
+	_, err = p.TrafficSplit("exp", -1)
+	assert.Error(t, err)
+	_, err = p.TrafficSplit("exp", 7)
+	assert.Error(t, err)
+}
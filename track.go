@@ -0,0 +1,174 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+)
+
+// names of the tags of a tracked event that Optimizely reports as the revenue and value of the conversion
+const (
+	revenueTag = "revenue"
+	valueTag   = "value"
+)
+
+// ErrUntrackedEvent is returned by NewEvents when a TrackedEvent provided with TrackedConversion was not
+// created by Project.Track, e.g. a zero value.
+var ErrUntrackedEvent = xerrors.New("tracked event was not created by a project")
+
+// TrackedEvent is the conversion of a user on an event defined in the datafile, e.g. a purchase.
+// Like an Impression, a TrackedEvent is reported to the Optimizely API by creating events with it,
+// in this case with the TrackedConversion option.
+type TrackedEvent struct {
+	Key       string
+	UserID    string
+	Tags      map[string]interface{}
+	Timestamp time.Time
+	event     conversionEvent
+}
+
+// Revision returns the revision of the datafile that the tracked event was generated from, or an empty
+// string if the tracked event was not created by Project.Track.
+func (t TrackedEvent) Revision() string {
+	if t.event.project == nil {
+		return ""
+	}
+	return t.event.project.Revision
+}
+
+// Track records a conversion of the user on the event with the given key. The tags are reported
+// with the conversion; numeric "revenue" and "value" tags are also reported as the revenue and
+// value of the conversion, where revenue must be a whole number, e.g. in cents. If the event does not
+// exist in the datafile, nil is returned. The TrackedEvent returned by this method can be used later
+// to generate events for reporting to the Optimizely API.
+func (p Project) Track(eventKey, userID string, tags map[string]interface{}) *TrackedEvent {
+	ev, ok := p.events[eventKey]
+	if !ok {
+		return nil
+	}
+	var trackedTags map[string]interface{}
+	if len(tags) > 0 {
+		trackedTags = make(map[string]interface{}, len(tags))
+		for key, value := range tags {
+			trackedTags[key] = value
+		}
+	}
+	return &TrackedEvent{
+		Key:       eventKey,
+		UserID:    userID,
+		Tags:      trackedTags,
+		Timestamp: time.Now(),
+		event:     ev,
+	}
+}
+
+// TrackedConversion adds the tracked event to the set of reported events. Like ActivatedImpression,
+// each tracked event must have originated from the same Optimizely account as the other impressions
+// and tracked events or an error will be returned while creating the events. ErrUntrackedEvent is
+// returned if the tracked event was not created by Project.Track.
+func TrackedConversion(t TrackedEvent) func(*Events) error {
+	return func(e *Events) error {
+		if t.event.project == nil {
+			return ErrUntrackedEvent
+		}
+		if err := e.addProject(t.event.project); err != nil {
+			return err
+		}
+		e.Visitors = append(e.Visitors, t.toVisitor())
+		return nil
+	}
+}
+
+// toVisitor converts a tracked event to the visitor data structure for sending to the Optimizely API.
+func (t TrackedEvent) toVisitor() visitor {
+	ev := event{
+		EntityID:  t.event.id,
+		Type:      t.Key,
+		Key:       t.Key,
+		Timestamp: toEpochMillis(t.Timestamp),
+		UUID:      uuid.New().String(),
+		Tags:      t.Tags,
+	}
+	if revenue, ok := revenueTagValue(t.Tags[revenueTag]); ok {
+		ev.Revenue = &revenue
+	}
+	if value, ok := numericTagValue(t.Tags[valueTag]); ok {
+		ev.Value = &value
+	}
+	return visitor{
+		ID: t.UserID,
+		Snapshots: []snapshot{{
+			Decisions: []decision{},
+			Events:    []event{ev},
+		}},
+	}
+}
+
+// numericTagValue returns the value of a numeric tag and whether the tag is numeric.
+func numericTagValue(tag interface{}) (float64, bool) {
+	switch v := tag.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// revenueTagValue returns the value of a revenue tag and whether it is a whole number, as required
+// for revenue by the Optimizely API.
+func revenueTagValue(tag interface{}) (int64, bool) {
+	switch v := tag.(type) {
+	case int64:
+		return v, true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+	}
+	f, ok := numericTagValue(tag)
+	if !ok || f != math.Trunc(f) || math.Abs(f) >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
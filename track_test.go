@@ -0,0 +1,189 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+const trackingDatafile = `
+{
+  "version": "4",
+  "revision": "7",
+  "accountId": "1234",
+  "experiments": [
+    {
+      "status": "Running",
+      "id": "5678",
+      "layerId": "9012",
+      "key": "an_experiment",
+      "variations": [{"id": "abc123", "key": "variation_1"}],
+      "trafficAllocation": [{"entityId": "abc123", "endOfRange": 10000}]
+    }
+  ],
+  "events": [{"id": "3456", "key": "purchase", "experimentIds": ["5678"]}]
+}
+`
+
+func TestProject_Track(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(trackingDatafile))
+	require.NoError(t, err)
+	assert.Nil(t, project.Track("unknown", "user", nil))
+
+	tags := map[string]interface{}{"revenue": 1000}
+	tracked := project.Track("purchase", "user", tags)
+	require.NotNil(t, tracked)
+	assert.Equal(t, "purchase", tracked.Key)
+	assert.Equal(t, "user", tracked.UserID)
+	assert.Equal(t, "7", tracked.Revision())
+	assert.False(t, tracked.Timestamp.IsZero())
+	// the tags are copied so that later changes by the caller are not reported
+	tags["revenue"] = 2000
+	assert.Equal(t, map[string]interface{}{"revenue": 1000}, tracked.Tags)
+}
+
+func TestTrackedConversion(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(trackingDatafile))
+	require.NoError(t, err)
+	tests := []struct {
+		name          string
+		tags          map[string]interface{}
+		expectedEvent map[string]interface{}
+	}{
+		{
+			"no tags",
+			nil,
+			map[string]interface{}{"entity_id": "3456", "type": "purchase", "key": "purchase"},
+		}, {
+			"revenue and value",
+			map[string]interface{}{"revenue": 1000, "value": 2.5, "category": "shoes"},
+			map[string]interface{}{
+				"entity_id": "3456", "type": "purchase", "key": "purchase", "revenue": 1000.0, "value": 2.5,
+				"tags": map[string]interface{}{"revenue": 1000.0, "value": 2.5, "category": "shoes"},
+			},
+		}, {
+			"fractional revenue is only a tag",
+			map[string]interface{}{"revenue": 10.5},
+			map[string]interface{}{
+				"entity_id": "3456", "type": "purchase", "key": "purchase",
+				"tags": map[string]interface{}{"revenue": 10.5},
+			},
+		}, {
+			"non-numeric revenue and value are only tags",
+			map[string]interface{}{"revenue": "1000", "value": true},
+			map[string]interface{}{
+				"entity_id": "3456", "type": "purchase", "key": "purchase",
+				"tags": map[string]interface{}{"revenue": "1000", "value": true},
+			},
+		}, {
+			"json numbers",
+			map[string]interface{}{"revenue": json.Number("9007199254740993"), "value": json.Number("1.5")},
+			map[string]interface{}{
+				"entity_id": "3456", "type": "purchase", "key": "purchase", "revenue": 9007199254740993.0, "value": 1.5,
+				"tags": map[string]interface{}{"revenue": 9007199254740993.0, "value": 1.5},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracked := project.Track("purchase", "user", test.tags)
+			require.NotNil(t, tracked)
+			events, err := NewEvents(TrackedConversion(*tracked))
+			require.NoError(t, err)
+			assert.Equal(t, "1234", events.AccountID)
+			require.Len(t, events.Visitors, 1)
+			assert.Equal(t, "user", events.Visitors[0].ID)
+			require.Len(t, events.Visitors[0].Snapshots, 1)
+			assert.Empty(t, events.Visitors[0].Snapshots[0].Decisions)
+			require.Len(t, events.Visitors[0].Snapshots[0].Events, 1)
+
+			ev := events.Visitors[0].Snapshots[0].Events[0]
+			assert.Equal(t, toEpochMillis(tracked.Timestamp), ev.Timestamp)
+			eventJSON, err := json.Marshal(ev)
+			require.NoError(t, err)
+			var actual map[string]interface{}
+			require.NoError(t, json.Unmarshal(eventJSON, &actual))
+			delete(actual, "timestamp")
+			delete(actual, "uuid")
+			assert.Equal(t, test.expectedEvent, actual)
+		})
+	}
+}
+
+func TestTrackedEvent_zeroValue(t *testing.T) {
+	var tracked TrackedEvent
+	assert.Equal(t, "", tracked.Revision())
+	var err error
+	require.NotPanics(t, func() { _, err = NewEvents(TrackedConversion(tracked)) })
+	assert.True(t, xerrors.Is(err, ErrUntrackedEvent))
+}
+
+func TestRevenueTagValue(t *testing.T) {
+	tests := []struct {
+		name            string
+		tag             interface{}
+		expectedRevenue int64
+		expectedOk      bool
+	}{
+		{"int", 1000, 1000, true},
+		{"uint8", uint8(10), 10, true},
+		{"whole float", 1000.0, 1000, true},
+		{"fractional float", 10.5, 0, false},
+		{"large int64", int64(9007199254740993), 9007199254740993, true},
+		{"json integer", json.Number("9007199254740993"), 9007199254740993, true},
+		{"json whole float", json.Number("1e3"), 1000, true},
+		{"out of range", 1e19, 0, false},
+		{"string", "1000", 0, false},
+		{"missing", nil, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revenue, ok := revenueTagValue(test.tag)
+			assert.Equal(t, test.expectedOk, ok)
+			assert.Equal(t, test.expectedRevenue, revenue)
+		})
+	}
+}
+
+func TestTrackedConversion_withImpressions(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(trackingDatafile))
+	require.NoError(t, err)
+	impression := project.GetVariation("an_experiment", "user")
+	require.NotNil(t, impression)
+	tracked := project.Track("purchase", "user", nil)
+	require.NotNil(t, tracked)
+
+	events, err := NewEvents(ActivatedImpression(*impression), TrackedConversion(*tracked))
+	require.NoError(t, err)
+	require.Len(t, events.Visitors, 2)
+	assert.Equal(t, "campaign_activated", events.Visitors[0].Snapshots[0].Events[0].Type)
+	assert.Equal(t, "purchase", events.Visitors[1].Snapshots[0].Events[0].Type)
+
+	otherAccount := *tracked
+	otherAccount.event.project = &Project{AccountID: "other", Revision: "7"}
+	_, err = NewEvents(ActivatedImpression(*impression), TrackedConversion(otherAccount))
+	assert.True(t, xerrors.Is(err, ErrMixedAccounts))
+
+	otherRevision := *tracked
+	otherRevision.event.project = &Project{AccountID: "1234", Revision: "8"}
+	events, err = NewEvents(ActivatedImpression(*impression), TrackedConversion(otherRevision))
+	assert.NoError(t, err)
+	assert.Len(t, events.Visitors, 2)
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"fmt"
+)
+
+// BucketDistribution is the distribution of a sample of users across the variations of an
+// experiment, as reported by UniformityReport.
+type BucketDistribution struct {
+	// number of users bucketed into each variation, by variation key
+	Counts map[string]int
+	// number of users that were not bucketed into any variation
+	Unallocated int
+	// Pearson's chi-square statistic of the counts against the counts expected from the
+	// experiment's traffic allocation
+	ChiSquare float64
+	// degrees of freedom of the chi-square statistic
+	DegreesOfFreedom int
+}
+
+// UniformityReport buckets sampleSize synthetic user IDs into the experiment of the project and
+// reports how they are distributed across its variations. This is intended for validating bucketing,
+// e.g. with A/A tests in CI: the chi-square statistic of a uniform distribution should not exceed the
+// critical value for the degrees of freedom at the chosen significance level. Users are bucketed like
+// GetVariation buckets them, using the bucketing key, experiment namespace, and max traffic value of
+// the project, while forced variations, groups, and the status of the experiment are ignored.
+func (p Project) UniformityReport(experiment Experiment, sampleSize int) BucketDistribution {
+	report := BucketDistribution{Counts: make(map[string]int, len(experiment.trafficAllocation))}
+	for i := 0; i < sampleSize; i++ {
+		variation := p.bucket(experiment, fmt.Sprintf("user_%d", i))
+		if variation == nil {
+			report.Unallocated++
+			continue
+		}
+		report.Counts[variation.Key]++
+	}
+	if sampleSize <= 0 {
+		return report
+	}
+
+	// the share of traffic expected in each variation is the width of its ranges in the allocation
+	maxBucketValue := p.maxBucketValue()
+	expectedShares := make(map[string]int, len(experiment.trafficAllocation))
+	unallocatedShare := maxBucketValue
+	start := 0
+	for _, allocation := range experiment.trafficAllocation {
+		end := allocation.endOfRange
+		if end > maxBucketValue {
+			end = maxBucketValue
+		}
+		if end > start {
+			expectedShares[allocation.Variation.Key] += end - start
+			unallocatedShare -= end - start
+			start = end
+		}
+	}
+	categories := 0
+	addCategory := func(observed, share int) {
+		if share == 0 {
+			return
+		}
+		expected := float64(sampleSize) * float64(share) / float64(maxBucketValue)
+		report.ChiSquare += (float64(observed) - expected) * (float64(observed) - expected) / expected
+		categories++
+	}
+	for key, share := range expectedShares {
+		addCategory(report.Counts[key], share)
+	}
+	addCategory(report.Unallocated, unallocatedShare)
+	if categories > 0 {
+		report.DegreesOfFreedom = categories - 1
+	}
+	return report
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// critical values of the chi-square distribution at a significance level of 0.001 by degrees of freedom
+var chiSquareCriticalValues = map[int]float64{1: 10.828, 2: 13.816}
+
+func TestUniformityReport(t *testing.T) {
+	a := Variation{id: "a", Key: "a"}
+	b := Variation{id: "b", Key: "b"}
+	tests := []struct {
+		name              string
+		trafficAllocation []trafficAllocation
+		expectedShares    map[string]float64
+		expectedDoF       int
+	}{
+		{
+			"50/50 experiment is uniform",
+			[]trafficAllocation{{endOfRange: 5000, Variation: a}, {endOfRange: 10000, Variation: b}},
+			map[string]float64{"a": 0.5, "b": 0.5},
+			1,
+		}, {
+			"partially allocated experiment is uniform",
+			[]trafficAllocation{{endOfRange: 2000, Variation: a}, {endOfRange: 4000, Variation: b}},
+			map[string]float64{"a": 0.2, "b": 0.2, "": 0.6},
+			2,
+		},
+	}
+	const sampleSize = 100000
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := Project{}.UniformityReport(Experiment{id: "experiment", trafficAllocation: test.trafficAllocation}, sampleSize)
+			total := report.Unallocated
+			for _, count := range report.Counts {
+				total += count
+			}
+			assert.Equal(t, sampleSize, total)
+			for key, share := range test.expectedShares {
+				count := report.Unallocated
+				if key != "" {
+					count = report.Counts[key]
+				}
+				assert.InDelta(t, share, float64(count)/sampleSize, 0.01)
+			}
+			assert.Equal(t, test.expectedDoF, report.DegreesOfFreedom)
+			assert.True(
+				t, report.ChiSquare < chiSquareCriticalValues[test.expectedDoF],
+				"chi-square statistic %v exceeds critical value", report.ChiSquare)
+		})
+	}
+}
+
+func TestUniformityReport_emptySample(t *testing.T) {
+	experiment := Experiment{trafficAllocation: []trafficAllocation{{endOfRange: 10000, Variation: Variation{Key: "a"}}}}
+	assert.Equal(t, BucketDistribution{Counts: map[string]int{}}, Project{}.UniformityReport(experiment, 0))
+}
+
+func TestProject_UniformityReport_matchesGetVariation(t *testing.T) {
+	project, err := NewProjectFromDataFile([]byte(`
+{
+  "version": "4",
+  "experiments": [
+    {
+      "id": "1",
+      "key": "an_experiment",
+      "status": "Running",
+      "variations": [{"id": "a", "key": "a"}, {"id": "b", "key": "b"}],
+      "trafficAllocation": [{"entityId": "a", "endOfRange": 5000}, {"entityId": "b", "endOfRange": 10000}]
+    }
+  ]
+}
+`))
+	require.NoError(t, err)
+	project.SetMaxTrafficValue(20000)
+	project.SetBucketingKey(func(bucketingID, entityID string) string { return entityID + ":" + bucketingID })
+	project.SetExperimentNamespace("an_experiment", "v2")
+	experiment, ok := project.GetExperiment("an_experiment")
+	require.True(t, ok)
+
+	const sampleSize = 10000
+	report := project.UniformityReport(experiment, sampleSize)
+	expected := BucketDistribution{Counts: map[string]int{}}
+	for i := 0; i < sampleSize; i++ {
+		impression := project.GetVariation("an_experiment", fmt.Sprintf("user_%d", i))
+		if impression == nil {
+			expected.Unallocated++
+			continue
+		}
+		expected.Counts[impression.Key]++
+	}
+	assert.Equal(t, expected.Counts, report.Counts)
+	assert.Equal(t, expected.Unallocated, report.Unallocated)
+	// the allocation only covers half of the buckets of the max traffic value
+	assert.InDelta(t, 0.5, float64(report.Unallocated)/sampleSize, 0.02)
+	assert.Equal(t, 2, report.DegreesOfFreedom)
+	assert.True(t, report.ChiSquare < chiSquareCriticalValues[2], "chi-square statistic %v exceeds critical value", report.ChiSquare)
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spothero/optimizely-sdk-go/internal/mediatype"
+	"golang.org/x/xerrors"
+)
+
+// URL of the datafile of an environment on the Optimizely CDN, given the environment's SDK key
+const cdnDatafileURL = "https://cdn.optimizely.com/datafiles/%s.json"
+
+// NewProjectFromURL creates a new Optimizely project from the JSON datafile served at the given URL,
+// e.g. the Optimizely CDN URL of an environment's datafile, without using the Optimizely API. The
+// request is made with the given HTTP client, or http.DefaultClient if it is nil, and is canceled
+// when ctx is done. Like with the api package, responses whose content type shows that they are not
+// JSON, e.g. HTML error pages, are rejected. Like GetProject, the project records the Last-Modified time of the datafile, if
+// present, so that its age can be checked with DatafileAge.
+func NewProjectFromURL(ctx context.Context, datafileURL string, client *http.Client) (Project, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, datafileURL, nil)
+	if err != nil {
+		return Project{}, xerrors.Errorf("error creating datafile request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Project{}, xerrors.Errorf("error retrieving datafile from %s: %w", datafileURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Project{}, xerrors.Errorf("received %d status while retrieving datafile from %s", resp.StatusCode, datafileURL)
+	}
+	datafileJSON, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Project{}, xerrors.Errorf("error reading datafile from %s: %w", datafileURL, err)
+	}
+	// catch error pages, e.g. from a CDN, that would otherwise fail to parse as a datafile
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !mediatype.IsJSON(contentType, datafileJSON) {
+		return Project{}, xerrors.Errorf(
+			"unexpected content type %q received while retrieving datafile from %s", contentType, datafileURL)
+	}
+	project, err := NewProjectFromDataFile(datafileJSON)
+	if err != nil {
+		return Project{}, xerrors.Errorf("error creating project from datafile: %w", err)
+	}
+	// the Last-Modified header is informational, so the zero time is used if it can't be parsed
+	project.lastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return project, nil
+}
+
+// DatafileURL returns the URL of the project's datafile on the Optimizely CDN, derived from the SDK key
+// of the datafile, which can be passed to NewProjectFromURL to refresh the project. If the datafile
+// has no SDK key, an empty string is returned.
+func (p Project) DatafileURL() string {
+	if p.SDKKey == "" {
+		return ""
+	}
+	return fmt.Sprintf(cdnDatafileURL, url.PathEscape(p.SDKKey))
+}
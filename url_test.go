@@ -0,0 +1,111 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProjectFromURL(t *testing.T) {
+	datafile := `{"version": "4", "revision": "42", "projectId": "1234", "accountId": "5678"}`
+	lastModified := time.Date(2019, time.March, 4, 12, 30, 0, 0, time.UTC)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/datafile.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		_, _ = w.Write([]byte(datafile))
+	})
+	mux.HandleFunc("/invalid.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "3"}`))
+	})
+	mux.HandleFunc("/error.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<html><body>Service Unavailable</body></html>"))
+	})
+	mux.HandleFunc("/untyped.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "binary/octet-stream")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		_, _ = w.Write([]byte(datafile))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		client    *http.Client
+		expectErr bool
+	}{
+		{"datafile is fetched and parsed", "/datafile.json", nil, false},
+		{"configured client is used", "/datafile.json", server.Client(), false},
+		{"not found", "/missing.json", nil, true},
+		{"invalid datafile", "/invalid.json", nil, true},
+		{"HTML error page", "/error.html", nil, true},
+		{"other content type with JSON body", "/untyped.json", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project, err := NewProjectFromURL(context.Background(), server.URL+test.path, test.client)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "42", project.Revision)
+			assert.Equal(t, "1234", project.ProjectID)
+			assert.Equal(t, "5678", project.AccountID)
+			assert.Equal(t, []byte(datafile), []byte(project.RawDataFile))
+			assert.True(t, lastModified.Equal(project.lastModified))
+		})
+	}
+}
+
+func TestNewProjectFromURL_canceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := NewProjectFromURL(ctx, server.URL, nil)
+	assert.Error(t, err)
+}
+
+func TestProject_DatafileURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		datafile    string
+		expectedURL string
+	}{
+		{"sdk key", `{"version": "4", "sdkKey": "AbC123dEf"}`, "https://cdn.optimizely.com/datafiles/AbC123dEf.json"},
+		{"sdk key is escaped", `{"version": "4", "sdkKey": "a/b c"}`, "https://cdn.optimizely.com/datafiles/a%2Fb%20c.json"},
+		{"no sdk key", `{"version": "4"}`, ""},
+		{"empty sdk key", `{"version": "4", "sdkKey": ""}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project, err := NewProjectFromDataFile([]byte(test.datafile))
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedURL, project.DatafileURL())
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import "fmt"
+
+// ValidationOption configures the checks performed by ValidateDatafile.
+type ValidationOption func(*validationOptions)
+
+type validationOptions struct {
+	strict bool
+}
+
+// StrictValidation makes ValidateDatafile also require the datafile to have a non-empty accountId
+// and projectId. Events are attributed to the account and project of the datafile, so events
+// built from a datafile without them cannot be attributed by Optimizely.
+func StrictValidation() ValidationOption {
+	return func(o *validationOptions) {
+		o.strict = true
+	}
+}
+
+// ValidateDatafile checks that the datafile can be used to create a Project, returning the error
+// that NewProjectFromDataFile would return otherwise. This allows datafiles to be rejected, e.g.
+// before they are deployed, without using the resulting Project.
+func ValidateDatafile(datafileJSON []byte, options ...ValidationOption) error {
+	o := validationOptions{}
+	for _, option := range options {
+		option(&o)
+	}
+	project, err := NewProjectFromDataFile(datafileJSON)
+	if err != nil {
+		return err
+	}
+	if !o.strict {
+		return nil
+	}
+	if project.AccountID == "" {
+		return fmt.Errorf("datafile has no accountId")
+	}
+	if project.ProjectID == "" {
+		return fmt.Errorf("datafile has no projectId")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizely
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDatafile(t *testing.T) {
+	tests := []struct {
+		name        string
+		datafile    string
+		options     []ValidationOption
+		expectedErr string
+	}{
+		{"valid datafile", `{"version": "4", "accountId": "1", "projectId": "2"}`, nil, ""},
+		{"valid datafile in strict mode", `{"version": "4", "accountId": "1", "projectId": "2"}`, []ValidationOption{StrictValidation()}, ""},
+		{"empty account ID is allowed by default", `{"version": "4", "accountId": "", "projectId": "2"}`, nil, ""},
+		{
+			"empty account ID in strict mode",
+			`{"version": "4", "accountId": "", "projectId": "2"}`,
+			[]ValidationOption{StrictValidation()},
+			"datafile has no accountId",
+		}, {
+			"missing project ID in strict mode",
+			`{"version": "4", "accountId": "1"}`,
+			[]ValidationOption{StrictValidation()},
+			"datafile has no projectId",
+		}, {
+			"unsupported version",
+			`{"version": "3", "accountId": "1", "projectId": "2"}`,
+			nil,
+			"could not create project from unsupported datafile version 3",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateDatafile([]byte(test.datafile), test.options...)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.expectedErr)
+		})
+	}
+}